@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 头像缓存
+const (
+	AvatarCacheTTL  = time.Hour
+	AvatarCacheSize = 2000
+)
+
+// avatar 缓存的头像
+type avatar struct {
+	data        []byte
+	etag        string
+	contentType string
+	expire      time.Time
+}
+
+// avatarCache 按userId和userName缓存头像
+type avatarCache struct {
+	items map[string]*avatar
+	sync.Mutex
+}
+
+var avatars = &avatarCache{items: map[string]*avatar{}}
+
+func (c *avatarCache) get(key string) (*avatar, bool) {
+	c.Lock()
+	defer c.Unlock()
+	item, ok := c.items[key]
+	if !ok || time.Now().After(item.expire) {
+		return nil, false
+	}
+	return item, true
+}
+
+func (c *avatarCache) put(key string, data []byte) *avatar {
+	sum := sha1.Sum(data)
+	item := &avatar{
+		data:        data,
+		etag:        `"` + hex.EncodeToString(sum[:]) + `"`,
+		contentType: http.DetectContentType(data),
+		expire:      time.Now().Add(AvatarCacheTTL),
+	}
+	c.Lock()
+	defer c.Unlock()
+	if len(c.items) >= AvatarCacheSize {
+		now := time.Now()
+		for k, v := range c.items {
+			if now.After(v.expire) {
+				delete(c.items, k)
+			}
+		}
+	}
+	if len(c.items) >= AvatarCacheSize {
+		for k := range c.items {
+			delete(c.items, k)
+			break
+		}
+	}
+	c.items[key] = item
+	return item
+}
+
+// Avatar 代理联系人、群成员、群的头像 /avatar?userId=&userName=
+func (hw *httpWechat) Avatar(rw http.ResponseWriter, req *http.Request) {
+	req.ParseForm()
+	uuid := req.Form.Get("userId")
+	userName := req.Form.Get("userName")
+	webResp := new(Response)
+	ww, ok := hw.get(uuid)
+	if !ok {
+		webResp.Code = LoginFaildCode
+		webResp.Message = "请先登录"
+		hw.writeJSON(rw, req, "Avatar", uuid, webResp)
+		return
+	}
+	key := uuid + "\x00" + userName
+	item, ok := avatars.get(key)
+	if !ok {
+		logger.Printf("Avatar:userId=%s request:%s ip: %s", uuid, req.Form.Encode(), req.RemoteAddr)
+		buf := new(bytes.Buffer)
+		if err := ww.GetHeadImage(req.Context(), userName, buf); err != nil {
+			webResp.Code = MediaFaildCode
+			webResp.Message = err.Error()
+			hw.writeJSON(rw, req, "Avatar", uuid, webResp)
+			return
+		}
+		item = avatars.put(key, buf.Bytes())
+	}
+	serveAvatar(rw, req, item)
+}
+
+// serveAvatar 输出头像，If-None-Match命中时返回304
+func serveAvatar(rw http.ResponseWriter, req *http.Request, item *avatar) {
+	rw.Header().Set("ETag", item.etag)
+	rw.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(AvatarCacheTTL.Seconds())))
+	for _, etag := range strings.Split(req.Header.Get("If-None-Match"), ",") {
+		if etag = strings.TrimSpace(etag); etag == item.etag || etag == "*" {
+			rw.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	rw.Header().Set("Content-Type", item.contentType)
+	rw.Header().Set("Content-Length", fmt.Sprint(len(item.data)))
+	rw.Write(item.data)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServeAvatar(t *testing.T) {
+	cache := &avatarCache{items: map[string]*avatar{}}
+	item := cache.put("u\x00@friend", []byte("\x89PNG\r\n\x1a\nxxxx"))
+	if got, ok := cache.get("u\x00@friend"); !ok || got != item {
+		t.Fatal("avatar not cached")
+	}
+
+	rw := httptest.NewRecorder()
+	serveAvatar(rw, httptest.NewRequest(http.MethodGet, "/avatar", nil), item)
+	if rw.Code != http.StatusOK || rw.Header().Get("Content-Type") != "image/png" || rw.Header().Get("ETag") != item.etag {
+		t.Fatalf("%d %v", rw.Code, rw.Header())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/avatar", nil)
+	req.Header.Set("If-None-Match", `"other", `+item.etag)
+	rw = httptest.NewRecorder()
+	serveAvatar(rw, req, item)
+	if rw.Code != http.StatusNotModified || rw.Body.Len() != 0 {
+		t.Fatalf("%d %d", rw.Code, rw.Body.Len())
+	}
+}
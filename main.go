@@ -3,9 +3,15 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -20,13 +26,29 @@ const (
 	LoginFaildCode  = 108 + iota
 	FetchFaildCode
 	SendMessage
+	MediaFaildCode
+	ChatroomFaildCode
+	ContactFaildCode
 )
 
+// SearchLimit 搜索联系人默认返回的条数
+const SearchLimit = 20
+
 type httpWechat struct {
-	wechat map[string]*wechat.Wechat
+	wechat   map[string]*wechat.Wechat
+	store    wechat.SessionStore
+	progress map[string]*uploadProgress
+	policies map[string]wechat.FriendPolicy
 	sync.RWMutex
 }
 
+// uploadProgress 最近一次上传的进度
+type uploadProgress struct {
+	Name  string `json:"name"`
+	Sent  int64  `json:"sent"`
+	Total int64  `json:"total"`
+}
+
 // Response Response
 type Response struct {
 	Code    int    `json:"code"`
@@ -34,9 +56,24 @@ type Response struct {
 	UUID    string `json:"uuid"`
 }
 
+// sendResponse 发送结果，带上撤回需要的消息ID
+type sendResponse struct {
+	Response
+	Sent *wechat.SentMessage `json:"sent,omitempty"`
+}
+
 var logger = wechat.GetLogger()
 
-var wechatChan = make(chan *wechat.Wechat, 500)
+// sessionPath 登录信息保存目录
+var sessionPath = filepath.Join(wechat.GetRootPath(), "sessions")
+
+// loginTask 等待扫码登录的账号
+type loginTask struct {
+	key string
+	wx  *wechat.Wechat
+}
+
+var wechatChan = make(chan *loginTask, 500)
 
 func (hw *httpWechat) Qr(rw http.ResponseWriter, req *http.Request) {
 	rw.Header().Add("Content-Type", "application/json; charset=UTF-8")
@@ -49,12 +86,12 @@ func (hw *httpWechat) Qr(rw http.ResponseWriter, req *http.Request) {
 	uuid := req.Form.Get("userId")
 
 	logger.Printf("qr:userId=%s request:%s  ip: %s", uuid, req.Form.Encode(), req.RemoteAddr)
-	wx := wechat.NewWechat(logger)
+	wx := hw.newWechat(uuid)
 
 	qrurl, err := wx.GetQr()
 
 	// 放入待处理带缓存的channel
-	wechatChan <- wx
+	wechatChan <- &loginTask{key: uuid, wx: wx}
 
 	hw.Lock()
 	defer hw.Unlock()
@@ -91,7 +128,7 @@ func (hw *httpWechat) Login(rw http.ResponseWriter, req *http.Request) {
 	uuid := req.Form.Get("userId")
 	logger.Printf("login :userId=%s request:%s  ip: %s", uuid, req.Form.Encode(), req.RemoteAddr)
 	webResp := new(WebResp)
-	wechat, ok := hw.wechat[uuid]
+	wechat, ok := hw.get(uuid)
 	if ok && wechat.IsLogin() {
 		webResp.LoginStatus = "0"
 	} else {
@@ -115,7 +152,7 @@ func (hw *httpWechat) GetContactList(rw http.ResponseWriter, req *http.Request)
 	uuid := req.Form.Get("userId")
 	logger.Printf("GetContactList:userId=%s request:%s ip: %s", uuid, req.Form.Encode(), req.RemoteAddr)
 	webResp := new(WebResp)
-	ww, ok := hw.wechat[uuid]
+	ww, ok := hw.get(uuid)
 	log.Printf("uuid=%s %+v", uuid, ww)
 	if !ok {
 		webResp.Code = LoginFaildCode
@@ -143,89 +180,590 @@ func (hw *httpWechat) GetContactList(rw http.ResponseWriter, req *http.Request)
 	rw.Write(qrJSON)
 }
 
-func (hw *httpWechat) SendMessage(rw http.ResponseWriter, req *http.Request) {
-	rw.Header().Add("Content-Type", "application/json; charset=UTF-8")
+// Logout 退出登录，并删除保存的登录信息 /logout?userId=
+func (hw *httpWechat) Logout(rw http.ResponseWriter, req *http.Request) {
+	req.ParseForm()
+	uuid := req.Form.Get("userId")
+	logger.Printf("Logout:userId=%s request:%s ip: %s", uuid, req.Form.Encode(), req.RemoteAddr)
+	webResp := new(Response)
+	hw.Lock()
+	ww, ok := hw.wechat[uuid]
+	delete(hw.wechat, uuid)
+	delete(hw.progress, uuid)
+	hw.Unlock()
+	if !ok {
+		webResp.Code = LoginFaildCode
+		webResp.Message = "请先登录"
+	} else if err := ww.Logout(req.Context()); err != nil {
+		webResp.Code = LoginFaildCode
+		webResp.Message = err.Error()
+	}
+	// 退出后再删除，避免同步中保存的登录信息残留
+	if err := hw.store.Delete(uuid); err != nil {
+		logger.Printf("Logout:userId=%s delete session faild: %s", uuid, err.Error())
+	}
+	hw.writeJSON(rw, req, "Logout", uuid, webResp)
+}
 
+// GetGroupMembers 获取群成员 /getGroupMembers?userId=&group=
+func (hw *httpWechat) GetGroupMembers(rw http.ResponseWriter, req *http.Request) {
+	type WebResp struct {
+		Response
+		Group       string               `json:"group"`
+		NickName    string               `json:"nickName"`
+		MemberCount int                  `json:"memberCount"`
+		Members     []wechat.GroupMember `json:"members"`
+	}
 	req.ParseForm()
 	uuid := req.Form.Get("userId")
-	userName := req.Form.Get("userName")
-	message := req.Form.Get("message")
+	group := req.Form.Get("group")
+	logger.Printf("GetGroupMembers:userId=%s request:%s ip: %s", uuid, req.Form.Encode(), req.RemoteAddr)
+	webResp := &WebResp{Group: group}
+	ww, ok := hw.get(uuid)
+	if !ok {
+		webResp.Code = LoginFaildCode
+		webResp.Message = "请先登录"
+		hw.writeJSON(rw, req, "GetGroupMembers", uuid, webResp)
+		return
+	}
+	member, err := ww.GroupMembers(req.Context(), group)
+	if err != nil {
+		webResp.Code = FetchFaildCode
+		webResp.Message = err.Error()
+		hw.writeJSON(rw, req, "GetGroupMembers", uuid, webResp)
+		return
+	}
+	webResp.NickName = member.NickName
+	webResp.MemberCount = member.MemberCount
+	webResp.Members = member.MemberList
+	hw.writeJSON(rw, req, "GetGroupMembers", uuid, webResp)
+}
 
-	logger.Printf("SendMessage:userId=%s request:%s ip: %s", uuid, req.Form.Encode(), req.RemoteAddr)
+// SearchContacts 搜索联系人和群 /searchContacts?userId=&q=&limit=
+func (hw *httpWechat) SearchContacts(rw http.ResponseWriter, req *http.Request) {
+	type WebResp struct {
+		Response
+		Contacts []wechat.ContactMatch `json:"contacts"`
+	}
+	req.ParseForm()
+	uuid := req.Form.Get("userId")
+	logger.Printf("SearchContacts:userId=%s request:%s ip: %s", uuid, req.Form.Encode(), req.RemoteAddr)
+	webResp := new(WebResp)
+	ww, ok := hw.get(uuid)
+	if !ok {
+		webResp.Code = LoginFaildCode
+		webResp.Message = "请先登录"
+		hw.writeJSON(rw, req, "SearchContacts", uuid, webResp)
+		return
+	}
+	limit, err := strconv.Atoi(req.Form.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = SearchLimit
+	}
+	webResp.Contacts = ww.SearchContacts(req.Form.Get("q"), limit)
+	hw.writeJSON(rw, req, "SearchContacts", uuid, webResp)
+}
+
+// SetRemarkName 修改联系人备注 /setRemarkName?userId=&userName=&remark=
+func (hw *httpWechat) SetRemarkName(rw http.ResponseWriter, req *http.Request) {
+	req.ParseForm()
+	uuid := req.Form.Get("userId")
+	logger.Printf("SetRemarkName:userId=%s request:%s ip: %s", uuid, req.Form.Encode(), req.RemoteAddr)
 	webResp := new(Response)
+	ww, ok := hw.get(uuid)
+	if !ok {
+		webResp.Code = LoginFaildCode
+		webResp.Message = "请先登录"
+		hw.writeJSON(rw, req, "SetRemarkName", uuid, webResp)
+		return
+	}
+	if err := ww.SetRemarkName(req.Context(), req.Form.Get("userName"), req.Form.Get("remark")); err != nil {
+		webResp.Code = ContactFaildCode
+		webResp.Message = err.Error()
+	}
+	hw.writeJSON(rw, req, "SetRemarkName", uuid, webResp)
+}
+
+// FriendRequests 待处理的好友请求 /friendRequests?userId=
+func (hw *httpWechat) FriendRequests(rw http.ResponseWriter, req *http.Request) {
+	type WebResp struct {
+		Response
+		Requests []*wechat.FriendRequest `json:"requests"`
+	}
+	req.ParseForm()
+	uuid := req.Form.Get("userId")
+	logger.Printf("FriendRequests:userId=%s request:%s ip: %s", uuid, req.Form.Encode(), req.RemoteAddr)
+	webResp := new(WebResp)
+	ww, ok := hw.get(uuid)
+	if !ok {
+		webResp.Code = LoginFaildCode
+		webResp.Message = "请先登录"
+		hw.writeJSON(rw, req, "FriendRequests", uuid, webResp)
+		return
+	}
+	webResp.Requests = ww.FriendRequests()
+	hw.writeJSON(rw, req, "FriendRequests", uuid, webResp)
+}
+
+// AcceptFriend 通过好友请求 /acceptFriend?userId=&userName=
+func (hw *httpWechat) AcceptFriend(rw http.ResponseWriter, req *http.Request) {
+	req.ParseForm()
+	uuid := req.Form.Get("userId")
+	userName := req.Form.Get("userName")
+	logger.Printf("AcceptFriend:userId=%s request:%s ip: %s", uuid, req.Form.Encode(), req.RemoteAddr)
+	webResp := new(Response)
+	ww, ok := hw.get(uuid)
+	if !ok {
+		webResp.Code = LoginFaildCode
+		webResp.Message = "请先登录"
+		hw.writeJSON(rw, req, "AcceptFriend", uuid, webResp)
+		return
+	}
+	friendReq, ok := ww.GetFriendRequest(userName)
+	if !ok {
+		webResp.Code = ContactFaildCode
+		webResp.Message = "好友请求不存在"
+		hw.writeJSON(rw, req, "AcceptFriend", uuid, webResp)
+		return
+	}
+	if err := ww.AcceptFriend(req.Context(), friendReq); err != nil {
+		webResp.Code = ContactFaildCode
+		webResp.Message = err.Error()
+	}
+	hw.writeJSON(rw, req, "AcceptFriend", uuid, webResp)
+}
+
+// FriendPolicy 查看或设置自动通过好友请求 /friendPolicy?userId=&autoAccept=1&greeting=
+func (hw *httpWechat) FriendPolicy(rw http.ResponseWriter, req *http.Request) {
+	type WebResp struct {
+		Response
+		Policy wechat.FriendPolicy `json:"policy"`
+	}
+	req.ParseForm()
+	uuid := req.Form.Get("userId")
+	logger.Printf("FriendPolicy:userId=%s request:%s ip: %s", uuid, req.Form.Encode(), req.RemoteAddr)
+	webResp := new(WebResp)
+	hw.Lock()
+	policy, set := hw.policies[uuid]
 	ww, ok := hw.wechat[uuid]
+	if ok && !set {
+		// 恢复的登录信息里带有策略
+		policy = ww.FriendPolicy()
+	}
+	_, update := req.Form["autoAccept"]
+	if update {
+		policy.AutoAccept, _ = strconv.ParseBool(req.Form.Get("autoAccept"))
+		policy.Greeting = req.Form.Get("greeting")
+		hw.policies[uuid] = policy
+	}
+	hw.Unlock()
+	if ok && update {
+		ww.SetFriendPolicy(policy)
+	}
+	webResp.Policy = policy
+	hw.writeJSON(rw, req, "FriendPolicy", uuid, webResp)
+}
+
+// MarkRead 标记会话已读 /markRead?userId=&userName=
+func (hw *httpWechat) MarkRead(rw http.ResponseWriter, req *http.Request) {
+	req.ParseForm()
+	uuid := req.Form.Get("userId")
+	logger.Printf("MarkRead:userId=%s request:%s ip: %s", uuid, req.Form.Encode(), req.RemoteAddr)
+	webResp := new(Response)
+	ww, ok := hw.get(uuid)
 	if !ok {
 		webResp.Code = LoginFaildCode
 		webResp.Message = "请先登录"
-		qrJSON, err := json.Marshal(webResp)
-		if err != nil {
-			log.Print(err)
-		}
-		logger.Printf("GetContactList:userId=%s response%s ip: %s", uuid, qrJSON, req.RemoteAddr)
-		rw.Write(qrJSON)
+		hw.writeJSON(rw, req, "MarkRead", uuid, webResp)
 		return
 	}
-	err := ww.SendMsg(userName, message, false)
+	if err := ww.MarkRead(req.Context(), req.Form.Get("userName")); err != nil {
+		webResp.Code = SendMessage
+		webResp.Message = err.Error()
+	}
+	hw.writeJSON(rw, req, "MarkRead", uuid, webResp)
+}
 
-	qrJSON, err := json.Marshal(webResp)
+// Unread 各会话的未读数 /unread?userId=
+func (hw *httpWechat) Unread(rw http.ResponseWriter, req *http.Request) {
+	type WebResp struct {
+		Response
+		Unread map[string]int `json:"unread"`
+	}
+	req.ParseForm()
+	uuid := req.Form.Get("userId")
+	logger.Printf("Unread:userId=%s request:%s ip: %s", uuid, req.Form.Encode(), req.RemoteAddr)
+	webResp := new(WebResp)
+	ww, ok := hw.get(uuid)
+	if !ok {
+		webResp.Code = LoginFaildCode
+		webResp.Message = "请先登录"
+		hw.writeJSON(rw, req, "Unread", uuid, webResp)
+		return
+	}
+	webResp.Unread = ww.Unread()
+	hw.writeJSON(rw, req, "Unread", uuid, webResp)
+}
+
+func (hw *httpWechat) SendMessage(rw http.ResponseWriter, req *http.Request) {
+	req.ParseForm()
+	uuid := req.Form.Get("userId")
+	userName := req.Form.Get("userName")
+	message := req.Form.Get("message")
+
+	logger.Printf("SendMessage:userId=%s request:%s ip: %s", uuid, req.Form.Encode(), req.RemoteAddr)
+	webResp := new(sendResponse)
+	ww, ok := hw.get(uuid)
+	if !ok {
+		webResp.Code = LoginFaildCode
+		webResp.Message = "请先登录"
+		hw.writeJSON(rw, req, "SendMessage", uuid, webResp)
+		return
+	}
+	toUserName, err := ww.ResolveRecipient(userName)
 	if err != nil {
-		log.Print(err)
+		webResp.Code = SendMessage
+		webResp.Message = err.Error()
+		hw.writeJSON(rw, req, "SendMessage", uuid, webResp)
+		return
 	}
-	logger.Printf("SendMessage:userId=%s response%s ip: %s", uuid, qrJSON, req.RemoteAddr)
-	rw.Write(qrJSON)
+	sent, err := ww.SendMsg(toUserName, message, false)
+	if err != nil {
+		webResp.Code = SendMessage
+		webResp.Message = err.Error()
+	}
+	webResp.Sent = sent
+	hw.writeJSON(rw, req, "SendMessage", uuid, webResp)
+}
+
+// RevokeMessage 撤回已发送的消息
+func (hw *httpWechat) RevokeMessage(rw http.ResponseWriter, req *http.Request) {
+	req.ParseForm()
+	uuid := req.Form.Get("userId")
+	sent := &wechat.SentMessage{
+		MsgID:      req.Form.Get("msgId"),
+		LocalID:    req.Form.Get("localId"),
+		ToUserName: req.Form.Get("toUserName"),
+	}
+
+	logger.Printf("RevokeMessage:userId=%s request:%s ip: %s", uuid, req.Form.Encode(), req.RemoteAddr)
+	webResp := new(Response)
+	ww, ok := hw.get(uuid)
+	if !ok {
+		webResp.Code = LoginFaildCode
+		webResp.Message = "请先登录"
+		hw.writeJSON(rw, req, "RevokeMessage", uuid, webResp)
+		return
+	}
+	if err := ww.Revoke(req.Context(), sent); err != nil {
+		webResp.Code = SendMessage
+		webResp.Message = err.Error()
+	}
+	hw.writeJSON(rw, req, "RevokeMessage", uuid, webResp)
 }
 
 func (hw *httpWechat) SendImg(rw http.ResponseWriter, req *http.Request) {
-	rw.Header().Add("Content-Type", "application/json; charset=UTF-8")
+	hw.sendMedia(rw, req, "SendImg", true, (*wechat.Wechat).SendImageReader)
+}
 
-	req.ParseForm()
+func (hw *httpWechat) SendFile(rw http.ResponseWriter, req *http.Request) {
+	hw.sendMedia(rw, req, "SendFile", false, (*wechat.Wechat).SendFileReader)
+}
+
+// SendAuto 按文件内容发送图片、表情、视频或文件
+func (hw *httpWechat) SendAuto(rw http.ResponseWriter, req *http.Request) {
+	hw.sendMedia(rw, req, "SendAuto", false, (*wechat.Wechat).SendAutoReader)
+}
+
+// sendMedia 读取上传的文件、base64、url或path后发送，resize为true时按参数压缩图片
+func (hw *httpWechat) sendMedia(rw http.ResponseWriter, req *http.Request, name string, resize bool,
+	send func(*wechat.Wechat, context.Context, string, string, int64, io.Reader) (*wechat.SentMessage, error)) {
+	req.Body = http.MaxBytesReader(rw, req.Body, maxRequestSize)
+	parseErr := req.ParseMultipartForm(maxMemory)
 	uuid := req.Form.Get("userId")
 	userName := req.Form.Get("userName")
-	path := req.Form.Get("path")
 
-	logger.Printf("SendImg:userId=%s request:%s ip: %s", uuid, req.Form.Encode(), req.RemoteAddr)
-	webResp := new(Response)
-	ww, ok := hw.wechat[uuid]
+	logger.Printf("%s:userId=%s request:%s ip: %s", name, uuid, formForLog(req.Form), req.RemoteAddr)
+	webResp := new(sendResponse)
+	if parseErr != nil && parseErr != http.ErrNotMultipart {
+		webResp.Code = SendMessage
+		webResp.Message = fmt.Sprintf("读取请求失败，文件不能超过%dMB: %s", MaxMediaSize>>20, parseErr.Error())
+		hw.writeJSON(rw, req, name, uuid, webResp)
+		return
+	}
+	ww, ok := hw.get(uuid)
 	if !ok {
 		webResp.Code = LoginFaildCode
 		webResp.Message = "请先登录"
-		qrJSON, err := json.Marshal(webResp)
-		if err != nil {
-			log.Print(err)
-		}
-		logger.Printf("SendImg:userId=%s response%s ip: %s", uuid, qrJSON, req.RemoteAddr)
-		rw.Write(qrJSON)
+		hw.writeJSON(rw, req, name, uuid, webResp)
+		return
+	}
+	toUserName, err := ww.ResolveRecipient(userName)
+	if err != nil {
+		webResp.Code = SendMessage
+		webResp.Message = err.Error()
+		hw.writeJSON(rw, req, name, uuid, webResp)
 		return
 	}
-	err := ww.SendMedia(userName, path)
+	src, err := openMedia(req)
+	if err == nil && resize {
+		src, err = processImage(req.Form, src)
+	}
+	if err != nil {
+		webResp.Code = SendMessage
+		webResp.Message = err.Error()
+		hw.writeJSON(rw, req, name, uuid, webResp)
+		return
+	}
+	defer src.Close()
+	sent, err := send(ww, req.Context(), toUserName, src.name, src.size, src.reader)
 	if err != nil {
 		webResp.Message = err.Error()
 		webResp.Code = SendMessage
 	}
-	qrJSON, err := json.Marshal(webResp)
+	webResp.Sent = sent
+	hw.writeJSON(rw, req, name, uuid, webResp)
+}
+
+// CreateChatroom 建群 members用逗号分隔
+func (hw *httpWechat) CreateChatroom(rw http.ResponseWriter, req *http.Request) {
+	type WebResp struct {
+		Response
+		ChatRoomName string `json:"chatRoomName,omitempty"`
+	}
+	req.ParseForm()
+	uuid := req.Form.Get("userId")
+	logger.Printf("CreateChatroom:userId=%s request:%s ip: %s", uuid, req.Form.Encode(), req.RemoteAddr)
+	webResp := new(WebResp)
+	ww, ok := hw.get(uuid)
+	if !ok {
+		webResp.Code = LoginFaildCode
+		webResp.Message = "请先登录"
+		hw.writeJSON(rw, req, "CreateChatroom", uuid, webResp)
+		return
+	}
+	room, err := ww.CreateChatroom(req.Context(), req.Form.Get("topic"), formList(req.Form, "members"))
+	if err != nil {
+		webResp.Code = ChatroomFaildCode
+		webResp.Message = err.Error()
+	}
+	webResp.ChatRoomName = room
+	hw.writeJSON(rw, req, "CreateChatroom", uuid, webResp)
+}
+
+func (hw *httpWechat) AddChatroomMembers(rw http.ResponseWriter, req *http.Request) {
+	hw.updateChatroom(rw, req, "AddChatroomMembers", func(ww *wechat.Wechat, ctx context.Context, room string, form url.Values) error {
+		return ww.AddChatroomMembers(ctx, room, formList(form, "members"))
+	})
+}
+
+func (hw *httpWechat) DelChatroomMembers(rw http.ResponseWriter, req *http.Request) {
+	hw.updateChatroom(rw, req, "DelChatroomMembers", func(ww *wechat.Wechat, ctx context.Context, room string, form url.Values) error {
+		return ww.DelChatroomMembers(ctx, room, formList(form, "members"))
+	})
+}
+
+func (hw *httpWechat) InviteChatroomMembers(rw http.ResponseWriter, req *http.Request) {
+	hw.updateChatroom(rw, req, "InviteChatroomMembers", func(ww *wechat.Wechat, ctx context.Context, room string, form url.Values) error {
+		return ww.InviteChatroomMembers(ctx, room, formList(form, "members"))
+	})
+}
+
+func (hw *httpWechat) RenameChatroom(rw http.ResponseWriter, req *http.Request) {
+	hw.updateChatroom(rw, req, "RenameChatroom", func(ww *wechat.Wechat, ctx context.Context, room string, form url.Values) error {
+		return ww.RenameChatroom(ctx, room, form.Get("topic"))
+	})
+}
+
+// updateChatroom 按chatRoomName修改群
+func (hw *httpWechat) updateChatroom(rw http.ResponseWriter, req *http.Request, name string,
+	update func(*wechat.Wechat, context.Context, string, url.Values) error) {
+	req.ParseForm()
+	uuid := req.Form.Get("userId")
+	logger.Printf("%s:userId=%s request:%s ip: %s", name, uuid, req.Form.Encode(), req.RemoteAddr)
+	webResp := new(Response)
+	ww, ok := hw.get(uuid)
+	if !ok {
+		webResp.Code = LoginFaildCode
+		webResp.Message = "请先登录"
+		hw.writeJSON(rw, req, name, uuid, webResp)
+		return
+	}
+	if err := update(ww, req.Context(), req.Form.Get("chatRoomName"), req.Form); err != nil {
+		webResp.Code = ChatroomFaildCode
+		webResp.Message = err.Error()
+	}
+	hw.writeJSON(rw, req, name, uuid, webResp)
+}
+
+// formList 逗号分隔或重复的参数
+func formList(form url.Values, key string) []string {
+	var list []string
+	for _, value := range form[key] {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
+// Media 下载收到的图片、语音、视频、文件 /media/{msgId}?userId=
+func (hw *httpWechat) Media(rw http.ResponseWriter, req *http.Request) {
+	req.ParseForm()
+	uuid := req.Form.Get("userId")
+	msgID := strings.TrimPrefix(req.URL.Path, "/media/")
+	logger.Printf("Media:userId=%s msgId=%s request:%s ip: %s", uuid, msgID, req.Form.Encode(), req.RemoteAddr)
+	webResp := new(Response)
+	ww, ok := hw.get(uuid)
+	if !ok {
+		webResp.Code = LoginFaildCode
+		webResp.Message = "请先登录"
+		hw.writeJSON(rw, req, "Media", uuid, webResp)
+		return
+	}
+	msg, ok := ww.GetMessage(msgID)
+	if !ok {
+		webResp.Code = MediaFaildCode
+		webResp.Message = "消息不存在"
+		hw.writeJSON(rw, req, "Media", uuid, webResp)
+		return
+	}
+	if msg.FileName != "" && msg.MsgType == wechat.MsgTypeApp {
+		rw.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", msg.FileName))
+	}
+	cw := &countWriter{Writer: rw}
+	err := ww.DownloadMedia(req.Context(), msg, cw)
+	if err != nil {
+		logger.Printf("Media:userId=%s msgId=%s faild: %s", uuid, msgID, err.Error())
+		if cw.n == 0 {
+			rw.Header().Del("Content-Disposition")
+			webResp.Code = MediaFaildCode
+			webResp.Message = err.Error()
+			hw.writeJSON(rw, req, "Media", uuid, webResp)
+		}
+		return
+	}
+	logger.Printf("Media:userId=%s msgId=%s response %d bytes ip: %s", uuid, msgID, cw.n, req.RemoteAddr)
+}
+
+// UploadProgress 最近一次上传的进度
+func (hw *httpWechat) UploadProgress(rw http.ResponseWriter, req *http.Request) {
+	type WebResp struct {
+		Response
+		Progress *uploadProgress `json:"progress,omitempty"`
+	}
+	req.ParseForm()
+	uuid := req.Form.Get("userId")
+	webResp := new(WebResp)
+	hw.RLock()
+	progress, ok := hw.progress[uuid]
+	if ok {
+		p := *progress
+		webResp.Progress = &p
+	}
+	hw.RUnlock()
+	if !ok {
+		webResp.Code = FetchFaildCode
+		webResp.Message = "没有上传记录"
+	}
+	hw.writeJSON(rw, req, "UploadProgress", uuid, webResp)
+}
+
+// newWechat 创建账号并注册公共的处理
+func (hw *httpWechat) newWechat(key string) *wechat.Wechat {
+	wx := wechat.NewWechat(logger)
+	wx.SetSessionStore(hw.store, key)
+	wx.OnUploadProgress(func(wx *wechat.Wechat, name string, sent, total int64) {
+		hw.Lock()
+		defer hw.Unlock()
+		hw.progress[key] = &uploadProgress{Name: name, Sent: sent, Total: total}
+	})
+	hw.RLock()
+	if policy, ok := hw.policies[key]; ok {
+		wx.SetFriendPolicy(policy)
+	}
+	hw.RUnlock()
+	return wx
+}
+
+// get 按userId获取已登录的账号
+func (hw *httpWechat) get(uuid string) (*wechat.Wechat, bool) {
+	hw.RLock()
+	defer hw.RUnlock()
+	ww, ok := hw.wechat[uuid]
+	return ww, ok
+}
+
+// writeJSON 输出json并记录日志
+func (hw *httpWechat) writeJSON(rw http.ResponseWriter, req *http.Request, name, uuid string, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	respJSON, err := json.Marshal(v)
 	if err != nil {
 		log.Print(err)
 	}
-	logger.Printf("SendImg:userId=%s response%s ip: %s", uuid, qrJSON, req.RemoteAddr)
-	rw.Write(qrJSON)
+	logger.Printf("%s:userId=%s response%s ip: %s", name, uuid, respJSON, req.RemoteAddr)
+	rw.Write(respJSON)
+}
+
+// countWriter 记录已写入的字节数
+type countWriter struct {
+	io.Writer
+	n int64
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	n, err := cw.Writer.Write(p)
+	cw.n += int64(n)
+	return n, err
 }
 
 func main() {
+	flag.Parse()
+	store, err := wechat.NewFileSessionStore(sessionPath)
+	if err != nil {
+		log.Fatal(err)
+	}
 	hw := httpWechat{
-		wechat: make(map[string]*wechat.Wechat),
+		wechat:   make(map[string]*wechat.Wechat),
+		store:    store,
+		progress: make(map[string]*uploadProgress),
+		policies: make(map[string]wechat.FriendPolicy),
 	}
 
 	// check login
 	ctx := context.Background()
+	hw.restore(ctx)
 	go hw.initLogin(ctx)
 
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("/qr", hw.Qr)
 	mux.HandleFunc("/checkLogin", hw.Login)
+	mux.HandleFunc("/logout", hw.Logout)
 	mux.HandleFunc("/getContactList", hw.GetContactList)
+	mux.HandleFunc("/getGroupMembers", hw.GetGroupMembers)
+	mux.HandleFunc("/searchContacts", hw.SearchContacts)
+	mux.HandleFunc("/setRemarkName", hw.SetRemarkName)
+	mux.HandleFunc("/friendRequests", hw.FriendRequests)
+	mux.HandleFunc("/acceptFriend", hw.AcceptFriend)
+	mux.HandleFunc("/friendPolicy", hw.FriendPolicy)
+	mux.HandleFunc("/markRead", hw.MarkRead)
+	mux.HandleFunc("/unread", hw.Unread)
 	mux.HandleFunc("/sendMessage", hw.SendMessage)
 	mux.HandleFunc("/sendImg", hw.SendImg)
+	mux.HandleFunc("/sendFile", hw.SendFile)
+	mux.HandleFunc("/sendAuto", hw.SendAuto)
+	mux.HandleFunc("/revokeMessage", hw.RevokeMessage)
+	mux.HandleFunc("/createChatroom", hw.CreateChatroom)
+	mux.HandleFunc("/addChatroomMembers", hw.AddChatroomMembers)
+	mux.HandleFunc("/delChatroomMembers", hw.DelChatroomMembers)
+	mux.HandleFunc("/inviteChatroomMembers", hw.InviteChatroomMembers)
+	mux.HandleFunc("/renameChatroom", hw.RenameChatroom)
+	mux.HandleFunc("/media/", hw.Media)
+	mux.HandleFunc("/avatar", hw.Avatar)
+	mux.HandleFunc("/uploadProgress", hw.UploadProgress)
 
 	addr := fmt.Sprintf(":%d", HTTPPort)
 
@@ -234,25 +772,75 @@ func main() {
 	log.Fatal(http.ListenAndServe(addr, mux))
 }
 
-// 常驻线程 检查是否有人登录了/media/madison/工作/vue/vue-element-admin/src/assets/401_images/401.gif
+// 常驻线程 检查是否有人登录了
 func (hw *httpWechat) initLogin(ctx context.Context) {
-	for wx := range wechatChan {
-		if !wx.IsLogin() {
-			loginCtx, cancel := context.WithDeadline(ctx, time.Now().Add(120*time.Second))
-			fmt.Println(cancel)
-			go wx.Login(loginCtx)
+	for task := range wechatChan {
+		if !task.wx.IsLogin() {
+			go hw.login(ctx, task)
 		}
 	}
 }
 
-func (hw *httpWechat) syncCheck() {
-	for key, wx := range hw.wechat {
-		go func(key string, wx *wechat.Wechat) {
-			syncResp, err := wx.SyncCheck()
-			if err != nil {
-				delete(hw.wechat, key)
-			}
-			fmt.Println(syncResp)
-		}(key, wx)
+// login 等待扫码，登录成功后开始同步消息
+func (hw *httpWechat) login(ctx context.Context, task *loginTask) {
+	loginCtx, cancel := context.WithDeadline(ctx, time.Now().Add(120*time.Second))
+	err := task.wx.Login(loginCtx)
+	cancel()
+	if err != nil || !task.wx.IsLogin() {
+		return
+	}
+	// 扫码期间已经调用了/logout
+	if ww, ok := hw.get(task.key); !ok || ww != task.wx {
+		logger.Printf("login:userId=%s removed during login", task.key)
+		task.wx.Logout(ctx)
+		if !ok {
+			hw.store.Delete(task.key)
+		}
+		return
+	}
+	hw.keepAlive(ctx, task.key, task.wx)
+}
+
+// keepAlive 同步消息，会话结束后从列表中移除
+func (hw *httpWechat) keepAlive(ctx context.Context, key string, wx *wechat.Wechat) {
+	// 登录或恢复后UserName会变，先获取联系人以便按备注、昵称发送和搜索
+	if _, err := wx.GetContactList(); err != nil {
+		logger.Printf("keepAlive:userId=%s GetContactList faild: %s", key, err.Error())
+	}
+	err := wx.Run(ctx)
+	logger.Printf("keepAlive:userId=%s stop: %v", key, err)
+	if _, ok := err.(*wechat.LogoutError); ok {
+		hw.store.Delete(key)
+	}
+
+	hw.Lock()
+	defer hw.Unlock()
+	if hw.wechat[key] == wx {
+		delete(hw.wechat, key)
+	}
+}
+
+// restore 恢复保存的登录信息并继续同步
+func (hw *httpWechat) restore(ctx context.Context) {
+	keys, err := hw.store.Keys()
+	if err != nil {
+		logger.Printf("restore faild: %s", err.Error())
+		return
+	}
+	for _, key := range keys {
+		session, err := hw.store.Load(key)
+		if err != nil {
+			logger.Printf("restore:userId=%s faild: %s", key, err.Error())
+			continue
+		}
+		// newWechat会加锁，先创建好再放入列表
+		wx := hw.newWechat(key)
+		wx.Restore(session)
+		hw.Lock()
+		hw.wechat[key] = wx
+		hw.policies[key] = wx.FriendPolicy()
+		hw.Unlock()
+		logger.Printf("restore:userId=%s uuid=%s", key, wx.GetUUID())
+		go hw.keepAlive(ctx, key, wx)
 	}
 }
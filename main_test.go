@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/daymenu/wxapi/wechat"
+)
+
+func TestRestore(t *testing.T) {
+	store := wechat.NewMemorySessionStore()
+	// 连接不上的地址，同步会一直失败直到退出
+	host := wechat.Host{Login: "127.0.0.1:1", File: "127.0.0.1:1", Push: "127.0.0.1:1"}
+	store.Save("u1", &wechat.Session{
+		UUID:        "uuid1",
+		BaseRequest: wechat.BaseRequest{Wxuin: 1, Wxsid: "sid", Skey: "skey"},
+		PassTicket:  "ticket",
+		Host:        host,
+		Friend:      wechat.FriendPolicy{AutoAccept: true, Greeting: "hi"},
+	})
+	hw := &httpWechat{
+		wechat:   make(map[string]*wechat.Wechat),
+		store:    store,
+		progress: make(map[string]*uploadProgress),
+		policies: make(map[string]wechat.FriendPolicy),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		hw.restore(ctx)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("restore blocked")
+	}
+
+	wx, ok := hw.get("u1")
+	if !ok || !wx.IsLogin() || wx.GetUUID() != "uuid1" {
+		t.Fatalf("session not restored: %v", ok)
+	}
+	hw.RLock()
+	policy := hw.policies["u1"]
+	hw.RUnlock()
+	if !policy.AutoAccept || policy.Greeting != "hi" {
+		t.Fatalf("%+v", policy)
+	}
+
+	if err := wx.Logout(ctx); err == nil {
+		t.Fatal("webwxlogout should fail")
+	}
+	for i := 0; i < 50; i++ {
+		if _, ok := hw.get("u1"); !ok {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatal("keepAlive not stopped")
+}
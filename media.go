@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/daymenu/wxapi/wechat"
+)
+
+// 上传限制，请求体要能放下base64编码后的文件
+const (
+	MaxMediaSize   = 100 << 20
+	maxMemory      = 32 << 20
+	maxRequestSize = MaxMediaSize/3*4 + 1<<20
+)
+
+var mediaDirs = flag.String("mediaDirs", "", "允许按path发送文件的目录，多个用逗号分隔，为空时不允许按path发送")
+
+// mediaClient 下载url文件，不允许访问内网地址
+var mediaClient = &http.Client{
+	Timeout: 2 * time.Minute,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 30 * time.Second,
+			Control: publicAddrOnly,
+		}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+}
+
+// publicAddrOnly 拒绝连接回环、内网、链路本地等地址，在解析域名之后检查，重定向同样生效
+func publicAddrOnly(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicIP(ip) {
+		return fmt.Errorf("不允许访问该地址: %s", host)
+	}
+	return nil
+}
+
+// isPublicIP 公网单播地址
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, block := range privateBlocks {
+		if block.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// privateBlocks 内网、运营商NAT、保留地址
+var privateBlocks = func() []*net.IPNet {
+	var blocks []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",
+		"10.0.0.0/8",
+		"100.64.0.0/10",
+		"172.16.0.0/12",
+		"192.0.0.0/24",
+		"192.168.0.0/16",
+		"198.18.0.0/15",
+		"240.0.0.0/4",
+		"fc00::/7",
+	} {
+		_, block, _ := net.ParseCIDR(cidr)
+		blocks = append(blocks, block)
+	}
+	return blocks
+}()
+
+// mediaSource 待发送的文件
+type mediaSource struct {
+	name   string
+	size   int64
+	reader io.Reader
+	close  func()
+}
+
+// Close 关闭文件、删除临时文件
+func (src *mediaSource) Close() {
+	if src.close != nil {
+		src.close()
+	}
+}
+
+// openMedia 按 file(multipart) > data(base64) > url > path 的顺序读取要发送的文件
+func openMedia(req *http.Request) (*mediaSource, error) {
+	name := req.Form.Get("name")
+	if f, header, err := req.FormFile("file"); err == nil {
+		if name == "" {
+			name = header.Filename
+		}
+		if header.Size > MaxMediaSize {
+			f.Close()
+			return nil, fmt.Errorf("文件超过%dMB", MaxMediaSize>>20)
+		}
+		return &mediaSource{name: filepath.Base(name), size: header.Size, reader: f, close: func() { f.Close() }}, nil
+	}
+	if data := req.Form.Get("data"); data != "" {
+		if base64.StdEncoding.DecodedLen(len(data)) > MaxMediaSize {
+			return nil, fmt.Errorf("文件超过%dMB", MaxMediaSize>>20)
+		}
+		content, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return nil, fmt.Errorf("data不是有效的base64: %s", err.Error())
+		}
+		if name == "" {
+			return nil, fmt.Errorf("请指定文件名name")
+		}
+		return &mediaSource{name: filepath.Base(name), size: int64(len(content)), reader: bytes.NewReader(content)}, nil
+	}
+	if rawURL := req.Form.Get("url"); rawURL != "" {
+		return fetchMedia(req, rawURL, name)
+	}
+	if p := req.Form.Get("path"); p != "" {
+		return openAllowedPath(p)
+	}
+	return nil, fmt.Errorf("请上传file，或指定data、url")
+}
+
+// fetchMedia 下载url指向的文件
+func fetchMedia(req *http.Request, rawURL, name string) (*mediaSource, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("url只支持http、https")
+	}
+	fetchReq, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := mediaClient.Do(fetchReq.WithContext(req.Context()))
+	if err != nil {
+		return nil, fmt.Errorf("下载文件失败: %s", err.Error())
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("下载文件失败: status code = %d", resp.StatusCode)
+	}
+	if name == "" {
+		name = path.Base(u.Path)
+	}
+	if name == "" || name == "." || name == "/" {
+		name = "file"
+	}
+	if resp.ContentLength > MaxMediaSize {
+		resp.Body.Close()
+		return nil, fmt.Errorf("文件超过%dMB", MaxMediaSize>>20)
+	}
+	if resp.ContentLength > 0 {
+		return &mediaSource{name: name, size: resp.ContentLength, reader: resp.Body, close: func() { resp.Body.Close() }}, nil
+	}
+
+	// 不知道大小时先写到临时文件
+	defer resp.Body.Close()
+	tmp, err := ioutil.TempFile("", "wxapi-media-")
+	if err != nil {
+		return nil, err
+	}
+	src := &mediaSource{name: name, reader: tmp, close: func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}}
+	src.size, err = io.Copy(tmp, io.LimitReader(resp.Body, MaxMediaSize+1))
+	if err == nil && src.size > MaxMediaSize {
+		err = fmt.Errorf("文件超过%dMB", MaxMediaSize>>20)
+	}
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		src.Close()
+		return nil, err
+	}
+	return src, nil
+}
+
+// openAllowedPath 只允许打开mediaDirs下的文件
+func openAllowedPath(p string) (*mediaSource, error) {
+	filePath, err := realPath(p)
+	if err != nil {
+		return nil, fmt.Errorf("文件不存在")
+	}
+	allowed := false
+	for _, dir := range strings.Split(*mediaDirs, ",") {
+		if strings.TrimSpace(dir) == "" {
+			continue
+		}
+		realDir, err := realPath(strings.TrimSpace(dir))
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(realDir, filePath)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return nil, fmt.Errorf("不允许发送该路径的文件")
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	fStat, err := f.Stat()
+	if err != nil || fStat.IsDir() {
+		f.Close()
+		return nil, fmt.Errorf("文件不存在")
+	}
+	return &mediaSource{name: fStat.Name(), size: fStat.Size(), reader: f, close: func() { f.Close() }}, nil
+}
+
+// processImage 传了maxWidth、maxHeight、quality时压缩图片并转为jpeg，不是图片或是gif动图时原样返回
+func processImage(form url.Values, src *mediaSource) (*mediaSource, error) {
+	opts := wechat.ImageOptions{}
+	params := map[string]*int{
+		"maxWidth":  &opts.MaxWidth,
+		"maxHeight": &opts.MaxHeight,
+		"quality":   &opts.Quality,
+	}
+	process := false
+	for key, value := range params {
+		v := form.Get(key)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			src.Close()
+			return nil, fmt.Errorf("%s参数错误", key)
+		}
+		*value = n
+		process = true
+	}
+	if !process {
+		return src, nil
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(src.reader, MaxMediaSize))
+	src.Close()
+	if err != nil {
+		return nil, err
+	}
+	if http.DetectContentType(data) == "image/gif" {
+		return &mediaSource{name: src.name, size: int64(len(data)), reader: bytes.NewReader(data)}, nil
+	}
+	processed, err := wechat.ProcessImage(data, opts)
+	if err == image.ErrFormat {
+		return &mediaSource{name: src.name, size: int64(len(data)), reader: bytes.NewReader(data)}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSuffix(src.name, filepath.Ext(src.name)) + ".jpg"
+	return &mediaSource{name: name, size: int64(len(processed)), reader: bytes.NewReader(processed)}, nil
+}
+
+// realPath 绝对路径并解析软链接
+func realPath(p string) (string, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
+
+// formForLog 日志中去掉base64内容
+func formForLog(form url.Values) string {
+	logForm := url.Values{}
+	for key, values := range form {
+		if key == "data" {
+			continue
+		}
+		logForm[key] = values
+	}
+	return logForm.Encode()
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenAllowedPath(t *testing.T) {
+	root, err := ioutil.TempDir("", "wxapi-dirs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	allowed := filepath.Join(root, "allowed")
+	other := filepath.Join(root, "allowed-other")
+	os.Mkdir(allowed, 0755)
+	os.Mkdir(other, 0755)
+	ioutil.WriteFile(filepath.Join(allowed, "a.png"), []byte("png"), 0644)
+	ioutil.WriteFile(filepath.Join(other, "b.png"), []byte("png"), 0644)
+	os.Symlink(filepath.Join(other, "b.png"), filepath.Join(allowed, "link.png"))
+
+	defer func(dirs string) { *mediaDirs = dirs }(*mediaDirs)
+	*mediaDirs = ""
+	if _, err := openAllowedPath(filepath.Join(allowed, "a.png")); err == nil {
+		t.Fatal("path sending should be disabled by default")
+	}
+
+	*mediaDirs = allowed
+	src, err := openAllowedPath(filepath.Join(allowed, "a.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.Close()
+	if src.name != "a.png" || src.size != 3 {
+		t.Fatalf("%+v", src)
+	}
+	for _, p := range []string{
+		filepath.Join(other, "b.png"),
+		filepath.Join(allowed, "..", "allowed-other", "b.png"),
+		filepath.Join(allowed, "link.png"),
+		allowed,
+	} {
+		if _, err := openAllowedPath(p); err == nil {
+			t.Errorf("%s should not be allowed", p)
+		}
+	}
+}
+
+func TestFetchMediaRejectsPrivateAddr(t *testing.T) {
+	for ip, public := range map[string]bool{
+		"8.8.8.8":         true,
+		"2001:4860::8888": true,
+		"127.0.0.1":       false,
+		"::1":             false,
+		"10.1.2.3":        false,
+		"172.20.0.1":      false,
+		"192.168.1.1":     false,
+		"169.254.169.254": false,
+		"fe80::1":         false,
+		"fd00::1":         false,
+		"0.0.0.0":         false,
+	} {
+		if isPublicIP(net.ParseIP(ip)) != public {
+			t.Fatalf("%s: public=%v", ip, !public)
+		}
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte("secret"))
+	}))
+	defer server.Close()
+	req := httptest.NewRequest(http.MethodGet, "/sendAuto", nil)
+	if src, err := fetchMedia(req, server.URL+"/a.png", ""); err == nil {
+		src.Close()
+		t.Fatal("loopback url fetched")
+	}
+}
+
+func TestProcessImageKeepsGif(t *testing.T) {
+	gif := []byte("GIF89a\x01\x00\x01\x00\x80\x00\x00\x00\x00\x00\xff\xff\xff!\xf9\x04\x01\x00\x00\x00\x00,\x00\x00\x00\x00\x01\x00\x01\x00\x00\x02\x02D\x01\x00;")
+	form := url.Values{"maxWidth": {"10"}}
+	src, err := processImage(form, &mediaSource{name: "a.gif", size: int64(len(gif)), reader: bytes.NewReader(gif)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(src.reader)
+	if src.name != "a.gif" || !bytes.Equal(data, gif) {
+		t.Fatalf("%s %d", src.name, len(data))
+	}
+}
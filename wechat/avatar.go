@@ -0,0 +1,57 @@
+package wechat
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// GetHeadImage 下载联系人、群成员或群的头像
+func (w *Wechat) GetHeadImage(ctx context.Context, userName string, dst io.Writer) error {
+	if userName == "" {
+		return fmt.Errorf("联系人不能为空")
+	}
+	return w.download(ctx, w.headImageURL(userName), nil, dst)
+}
+
+// headImageURL 优先使用联系人自带的HeadImgUrl，群成员需要带上chatroomid
+func (w *Wechat) headImageURL(userName string) string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if member, ok := w.MemberMap[userName]; ok && strings.HasPrefix(member.HeadImgURL, APIPath+"/") {
+		return "https://" + w.host.Login + member.HeadImgURL
+	}
+
+	query := url.Values{}
+	query.Set("seq", "0")
+	query.Set("username", userName)
+	query.Set("skey", w.Request.BaseRequest.Skey)
+	if strings.HasPrefix(userName, "@@") {
+		return w.apiURL(WebWxGetHeadImgPath) + "?" + query.Encode()
+	}
+	if chatRoomID := w.chatRoomOf(userName); chatRoomID != "" {
+		query.Set("chatroomid", chatRoomID)
+	}
+	return w.apiURL(WebWxGetIconPath) + "?" + query.Encode()
+}
+
+// chatRoomOf 查找群成员所在的群，需要持有w.mu
+func (w *Wechat) chatRoomOf(userName string) string {
+	for _, group := range w.MemberMap {
+		if !strings.HasPrefix(group.UserName, "@@") {
+			continue
+		}
+		for _, member := range group.MemberList {
+			if member.UserName != userName {
+				continue
+			}
+			if group.EncryChatRoomID != "" {
+				return group.EncryChatRoomID
+			}
+			return group.UserName
+		}
+	}
+	return ""
+}
@@ -0,0 +1,44 @@
+package wechat
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestGetHeadImage(t *testing.T) {
+	w, server := newTestWechat(t, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+		switch req.URL.Path {
+		case APIPath + WebWxGetIconPath:
+			if query.Get("skey") != "skey" {
+				t.Errorf("skey: %s", query.Get("skey"))
+			}
+			rw.Write([]byte("icon:" + query.Get("username") + ":" + query.Get("chatroomid") + ":" + query.Get("seq")))
+		case APIPath + WebWxGetHeadImgPath:
+			rw.Write([]byte("head:" + query.Get("username")))
+		default:
+			http.NotFound(rw, req)
+		}
+	}))
+	defer server.Close()
+
+	w.MemberMap["@friend"] = Member{UserName: "@friend", HeadImgURL: APIPath + WebWxGetIconPath + "?seq=42&username=@friend&skey=skey"}
+	w.MemberMap["@@room"] = Member{UserName: "@@room", EncryChatRoomID: "@encry", MemberList: []GroupMember{{UserName: "@member"}}}
+	cases := map[string]string{
+		"@friend":   "icon:@friend::42",
+		"@member":   "icon:@member:@encry:0",
+		"@stranger": "icon:@stranger::0",
+		"@@room":    "head:@@room",
+	}
+	for userName, want := range cases {
+		buf := new(bytes.Buffer)
+		if err := w.GetHeadImage(context.Background(), userName, buf); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != want {
+			t.Fatalf("%s: %s", userName, buf.String())
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package wechat
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// update chatroom fun
+const (
+	ChatroomAddMember    = "addmember"
+	ChatroomDelMember    = "delmember"
+	ChatroomInviteMember = "invitemember"
+	ChatroomModTopic     = "modtopic"
+)
+
+// CreateChatroom 建群，成员至少两个，返回群的UserName
+func (w *Wechat) CreateChatroom(ctx context.Context, topic string, members []string) (string, error) {
+	if !w.IsLogin() {
+		return "", fmt.Errorf("请重新登录")
+	}
+	if len(members) < 2 {
+		return "", fmt.Errorf("建群至少需要两个成员")
+	}
+	w.Log.Printf("%s CreateChatroom: topic=%s members=%d", w.GetUUID(), topic, len(members))
+	wxurl := fmt.Sprintf("%s?r=%d&lang=zh_CN&pass_ticket=%s",
+		w.apiURL(WebWxCreateChatroomPath), time.Now().Unix(), w.Request.BaseRequest.PassTicket)
+	params := &Request{
+		BaseRequest: w.Request.BaseRequest,
+		MemberCount: len(members),
+		Topic:       topic,
+	}
+	for _, userName := range members {
+		params.MemberList = append(params.MemberList, User{UserName: userName})
+	}
+	resp := new(ChatroomResp)
+	if err := w.postJSON(ctx, wxurl, params, resp); err != nil {
+		w.Log.Printf("%s CreateChatroom faild: %s", w.GetUUID(), err.Error())
+		return "", err
+	}
+	if err := retError("建群失败", resp.BaseResponse); err != nil {
+		return "", err
+	}
+	if resp.ChatRoomName == "" {
+		return "", fmt.Errorf("建群失败: 没有返回群ID")
+	}
+	group := Member{
+		UserName:    resp.ChatRoomName,
+		NickName:    resp.Topic,
+		MemberCount: resp.MemberCount,
+	}
+	if group.NickName == "" {
+		group.NickName = topic
+	}
+	w.mu.Lock()
+	w.setMember(group)
+	w.GroupMemberList = append(w.GroupMemberList, group)
+	w.mu.Unlock()
+	return resp.ChatRoomName, nil
+}
+
+// AddChatroomMembers 直接拉人进群
+func (w *Wechat) AddChatroomMembers(ctx context.Context, chatRoomName string, members []string) error {
+	if len(members) == 0 {
+		return fmt.Errorf("成员不能为空")
+	}
+	return w.updateChatroom(ctx, ChatroomAddMember, &Request{
+		ChatRoomName:  chatRoomName,
+		AddMemberList: strings.Join(members, ","),
+	})
+}
+
+// DelChatroomMembers 移出群成员，需要是群主
+func (w *Wechat) DelChatroomMembers(ctx context.Context, chatRoomName string, members []string) error {
+	if len(members) == 0 {
+		return fmt.Errorf("成员不能为空")
+	}
+	return w.updateChatroom(ctx, ChatroomDelMember, &Request{
+		ChatRoomName:  chatRoomName,
+		DelMemberList: strings.Join(members, ","),
+	})
+}
+
+// InviteChatroomMembers 发送入群邀请，群人数较多时只能邀请
+func (w *Wechat) InviteChatroomMembers(ctx context.Context, chatRoomName string, members []string) error {
+	if len(members) == 0 {
+		return fmt.Errorf("成员不能为空")
+	}
+	return w.updateChatroom(ctx, ChatroomInviteMember, &Request{
+		ChatRoomName:     chatRoomName,
+		InviteMemberList: strings.Join(members, ","),
+	})
+}
+
+// RenameChatroom 修改群名
+func (w *Wechat) RenameChatroom(ctx context.Context, chatRoomName, topic string) error {
+	if topic == "" {
+		return fmt.Errorf("群名不能为空")
+	}
+	err := w.updateChatroom(ctx, ChatroomModTopic, &Request{
+		ChatRoomName: chatRoomName,
+		NewTopic:     topic,
+	})
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if group, ok := w.MemberMap[chatRoomName]; ok {
+		group.NickName = topic
+		w.setMember(group)
+	}
+	return nil
+}
+
+// updateChatroom webwxupdatechatroom
+func (w *Wechat) updateChatroom(ctx context.Context, fun string, params *Request) error {
+	if !w.IsLogin() {
+		return fmt.Errorf("请重新登录")
+	}
+	if !strings.HasPrefix(params.ChatRoomName, "@@") {
+		return fmt.Errorf("群ID不正确: %s", params.ChatRoomName)
+	}
+	w.Log.Printf("%s updateChatroom: fun=%s chatroom=%s", w.GetUUID(), fun, params.ChatRoomName)
+	wxurl := fmt.Sprintf("%s?fun=%s&lang=zh_CN&pass_ticket=%s",
+		w.apiURL(WebWxUpdateChatroomPath), fun, w.Request.BaseRequest.PassTicket)
+	params.BaseRequest = w.Request.BaseRequest
+	resp := new(InnerResponse)
+	if err := w.postJSON(ctx, wxurl, params, resp); err != nil {
+		w.Log.Printf("%s updateChatroom faild: %s", w.GetUUID(), err.Error())
+		return err
+	}
+	return retError("群操作失败", resp.BaseResponse)
+}
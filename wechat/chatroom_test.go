@@ -0,0 +1,77 @@
+package wechat
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestChatroom(t *testing.T) {
+	updates := map[string]Request{}
+	var create Request
+	w, server := newTestWechat(t, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case APIPath + WebWxCreateChatroomPath:
+			json.NewDecoder(req.Body).Decode(&create)
+			rw.Write([]byte(`{"BaseResponse":{"Ret":0,"ErrMsg":""},"Topic":"war room","MemberCount":3,"ChatRoomName":"@@room"}`))
+		case APIPath + WebWxUpdateChatroomPath:
+			var params Request
+			json.NewDecoder(req.Body).Decode(&params)
+			updates[req.URL.Query().Get("fun")] = params
+			if params.DelMemberList == "@owner" {
+				rw.Write([]byte(`{"BaseResponse":{"Ret":1,"ErrMsg":"not owner"}}`))
+				return
+			}
+			rw.Write([]byte(`{"BaseResponse":{"Ret":0,"ErrMsg":""}}`))
+		default:
+			http.NotFound(rw, req)
+		}
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	if _, err := w.CreateChatroom(ctx, "war room", []string{"@a"}); err == nil {
+		t.Fatal("chatroom created with one member")
+	}
+	room, err := w.CreateChatroom(ctx, "war room", []string{"@a", "@b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if room != "@@room" || create.Topic != "war room" || create.MemberCount != 2 || len(create.MemberList) != 2 || create.MemberList[1].UserName != "@b" {
+		t.Fatalf("%s %+v", room, create)
+	}
+	if w.MemberMap[room].NickName != "war room" {
+		t.Fatalf("%+v", w.MemberMap[room])
+	}
+
+	if err := w.AddChatroomMembers(ctx, room, []string{"@c", "@d"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.InviteChatroomMembers(ctx, room, []string{"@e"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.DelChatroomMembers(ctx, room, []string{"@c"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.RenameChatroom(ctx, room, "postmortem"); err != nil {
+		t.Fatal(err)
+	}
+	if updates[ChatroomAddMember].AddMemberList != "@c,@d" ||
+		updates[ChatroomInviteMember].InviteMemberList != "@e" ||
+		updates[ChatroomDelMember].DelMemberList != "@c" ||
+		updates[ChatroomModTopic].NewTopic != "postmortem" ||
+		updates[ChatroomModTopic].ChatRoomName != room {
+		t.Fatalf("%+v", updates)
+	}
+	if w.MemberMap[room].NickName != "postmortem" {
+		t.Fatalf("%+v", w.MemberMap[room])
+	}
+
+	if err := w.DelChatroomMembers(ctx, room, []string{"@owner"}); err == nil {
+		t.Fatal("ret error ignored")
+	}
+	if err := w.AddChatroomMembers(ctx, "@friend", []string{"@c"}); err == nil {
+		t.Fatal("not a chatroom")
+	}
+}
@@ -0,0 +1,140 @@
+package wechat
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// loadContacts 登录或恢复后还没有获取过联系人时获取一次
+func (w *Wechat) loadContacts() error {
+	w.mu.RLock()
+	loaded := w.contactsLoaded
+	w.mu.RUnlock()
+	if loaded {
+		return nil
+	}
+	_, err := w.GetContactList()
+	return err
+}
+
+// BatchGetContact 批量获取联系人详情，群会带上群成员，每次最多BatchContactSize个
+func (w *Wechat) BatchGetContact(ctx context.Context, userNames []string) ([]Member, error) {
+	if !w.IsLogin() {
+		return nil, fmt.Errorf("请重新登录")
+	}
+	var contacts []Member
+	for start := 0; start < len(userNames); start += BatchContactSize {
+		end := start + BatchContactSize
+		if end > len(userNames) {
+			end = len(userNames)
+		}
+		batch, err := w.batchGetContact(ctx, userNames[start:end])
+		if err != nil {
+			return nil, err
+		}
+		contacts = append(contacts, batch...)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, contact := range contacts {
+		w.setMember(contact)
+		if !strings.HasPrefix(contact.UserName, "@@") {
+			continue
+		}
+		for i := range w.GroupMemberList {
+			if w.GroupMemberList[i].UserName == contact.UserName {
+				w.GroupMemberList[i] = contact
+			}
+		}
+	}
+	return contacts, nil
+}
+
+// batchGetContact webwxbatchgetcontact
+func (w *Wechat) batchGetContact(ctx context.Context, userNames []string) ([]Member, error) {
+	w.Log.Printf("%s BatchGetContact: count=%d", w.GetUUID(), len(userNames))
+	wxurl := fmt.Sprintf("%s?type=ex&r=%d&lang=zh_CN&pass_ticket=%s",
+		w.apiURL(WebWxBatchContactPath), time.Now().Unix(), w.Request.BaseRequest.PassTicket)
+	list := make([]map[string]string, 0, len(userNames))
+	w.mu.RLock()
+	for _, userName := range userNames {
+		list = append(list, map[string]string{
+			"UserName":        userName,
+			"EncryChatRoomId": w.MemberMap[userName].EncryChatRoomID,
+		})
+	}
+	w.mu.RUnlock()
+	params := map[string]interface{}{
+		"BaseRequest": w.Request.BaseRequest,
+		"Count":       len(list),
+		"List":        list,
+	}
+	resp := new(BatchContactResp)
+	if err := w.postJSON(ctx, wxurl, params, resp); err != nil {
+		w.Log.Printf("%s BatchGetContact faild: %s", w.GetUUID(), err.Error())
+		return nil, err
+	}
+	if err := retError("获取联系人失败", resp.BaseResponse); err != nil {
+		return nil, err
+	}
+	return resp.ContactList, nil
+}
+
+// GroupMembers 获取群详情和群成员
+func (w *Wechat) GroupMembers(ctx context.Context, group string) (*Member, error) {
+	if !strings.HasPrefix(group, "@@") {
+		return nil, fmt.Errorf("群ID不正确: %s", group)
+	}
+	contacts, err := w.BatchGetContact(ctx, []string{group})
+	if err != nil {
+		return nil, err
+	}
+	for _, contact := range contacts {
+		if contact.UserName == group {
+			return &contact, nil
+		}
+	}
+	return nil, fmt.Errorf("群不存在: %s", group)
+}
+
+// SetRemarkName 修改联系人备注
+func (w *Wechat) SetRemarkName(ctx context.Context, userName, remark string) error {
+	if !w.IsLogin() {
+		return fmt.Errorf("请重新登录")
+	}
+	if userName == "" {
+		return fmt.Errorf("联系人不能为空")
+	}
+	w.Log.Printf("%s SetRemarkName: userName=%s remark=%s", w.GetUUID(), userName, remark)
+	wxurl := fmt.Sprintf("%s?lang=zh_CN&pass_ticket=%s", w.apiURL(WebWxOplogPath), w.Request.BaseRequest.PassTicket)
+	params := map[string]interface{}{
+		"BaseRequest": w.Request.BaseRequest,
+		"CmdId":       OplogCmdRemarkName,
+		"RemarkName":  remark,
+		"UserName":    userName,
+	}
+	resp := new(InnerResponse)
+	if err := w.postJSON(ctx, wxurl, params, resp); err != nil {
+		w.Log.Printf("%s SetRemarkName faild: %s", w.GetUUID(), err.Error())
+		return err
+	}
+	if err := retError("修改备注失败", resp.BaseResponse); err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if member, ok := w.MemberMap[userName]; ok {
+		member.RemarkName = remark
+		w.setMember(member)
+	}
+	for i := range w.ContactList {
+		if w.ContactList[i].UserName == userName {
+			w.ContactList[i].RemarkName = remark
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package wechat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestBatchGetContact(t *testing.T) {
+	var batches []int
+	w, server := newTestWechat(t, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != APIPath+WebWxBatchContactPath || req.URL.Query().Get("type") != "ex" {
+			http.NotFound(rw, req)
+			return
+		}
+		params := struct {
+			Count int
+			List  []struct {
+				UserName        string
+				EncryChatRoomID string `json:"EncryChatRoomId"`
+			}
+		}{}
+		json.NewDecoder(req.Body).Decode(&params)
+		batches = append(batches, params.Count)
+		var contacts []string
+		for _, item := range params.List {
+			if item.UserName == "@@room" {
+				if item.EncryChatRoomID != "@encry" {
+					t.Errorf("EncryChatRoomId: %s", item.EncryChatRoomID)
+				}
+				contacts = append(contacts, `{"UserName":"@@room","NickName":"war room","MemberCount":2,"EncryChatRoomId":"@encry",
+					"MemberList":[{"UserName":"@a","NickName":"Alice","DisplayName":"oncall"},{"UserName":"@b","NickName":"Bob","DisplayName":""}]}`)
+				continue
+			}
+			contacts = append(contacts, fmt.Sprintf(`{"UserName":%q,"RemarkName":"r%s"}`, item.UserName, item.UserName))
+		}
+		fmt.Fprintf(rw, `{"BaseResponse":{"Ret":0,"ErrMsg":""},"Count":%d,"ContactList":[%s]}`, len(contacts), strings.Join(contacts, ","))
+	}))
+	defer server.Close()
+
+	w.MemberMap["@@room"] = Member{UserName: "@@room", EncryChatRoomID: "@encry"}
+	w.GroupMemberList = []Member{{UserName: "@@room"}}
+	var userNames []string
+	for i := 0; i < 120; i++ {
+		userNames = append(userNames, fmt.Sprintf("@u%d", i))
+	}
+	contacts, err := w.BatchGetContact(context.Background(), userNames)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contacts) != 120 || fmt.Sprint(batches) != "[50 50 20]" {
+		t.Fatalf("%d %v", len(contacts), batches)
+	}
+	if w.MemberMap["@u7"].RemarkName != "r@u7" {
+		t.Fatalf("%+v", w.MemberMap["@u7"])
+	}
+
+	group, err := w.GroupMembers(context.Background(), "@@room")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(group.MemberList) != 2 || group.MemberList[0].DisplayName != "oncall" || group.MemberList[1].NickName != "Bob" {
+		t.Fatalf("%+v", group)
+	}
+	if len(w.GroupMemberList[0].MemberList) != 2 || w.GroupMemberList[0].NickName != "war room" {
+		t.Fatalf("%+v", w.GroupMemberList)
+	}
+	if _, err := w.GroupMembers(context.Background(), "@friend"); err == nil {
+		t.Fatal("not a group")
+	}
+}
+
+func TestSetRemarkName(t *testing.T) {
+	var params struct {
+		CmdID      int `json:"CmdId"`
+		RemarkName string
+		UserName   string
+	}
+	w, server := newTestWechat(t, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != APIPath+WebWxOplogPath {
+			http.NotFound(rw, req)
+			return
+		}
+		json.NewDecoder(req.Body).Decode(&params)
+		if params.UserName == "@stranger" {
+			rw.Write([]byte(`{"BaseResponse":{"Ret":1,"ErrMsg":""}}`))
+			return
+		}
+		rw.Write([]byte(`{"BaseResponse":{"Ret":0,"ErrMsg":""}}`))
+	}))
+	defer server.Close()
+
+	w.MemberMap["@friend"] = Member{UserName: "@friend", NickName: "Alice"}
+	w.ContactList = []Member{w.MemberMap["@friend"]}
+	if err := w.SetRemarkName(context.Background(), "@friend", "customer-42"); err != nil {
+		t.Fatal(err)
+	}
+	if params.CmdID != OplogCmdRemarkName || params.RemarkName != "customer-42" || params.UserName != "@friend" {
+		t.Fatalf("%+v", params)
+	}
+	if w.MemberMap["@friend"].RemarkName != "customer-42" || w.ContactList[0].RemarkName != "customer-42" {
+		t.Fatalf("%+v %+v", w.MemberMap["@friend"], w.ContactList)
+	}
+	if err := w.SetRemarkName(context.Background(), "@stranger", "x"); err == nil {
+		t.Fatal("ret error ignored")
+	}
+}
+
+func TestGetContactListPages(t *testing.T) {
+	var pages []string
+	w, server := newTestWechat(t, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != APIPath+WebWxContactListPath {
+			http.NotFound(rw, req)
+			return
+		}
+		seq := req.URL.Query().Get("seq")
+		pages = append(pages, seq)
+		switch seq {
+		case "0":
+			rw.Write([]byte(`{"BaseResponse":{"Ret":0,"ErrMsg":""},"MemberCount":2,"Seq":7,"MemberList":[
+				{"UserName":"@a","NickName":"Alice"},{"UserName":"@@room","NickName":"war room"}]}`))
+		case "7":
+			rw.Write([]byte(`{"BaseResponse":{"Ret":0,"ErrMsg":""},"MemberCount":2,"Seq":0,"MemberList":[
+				{"UserName":"@b","NickName":"Bob"},{"UserName":"@mp","NickName":"news","VerifyFlag":24}]}`))
+		default:
+			t.Errorf("seq: %s", seq)
+		}
+	}))
+	defer server.Close()
+
+	w.MemberMap["@@room"] = Member{UserName: "@@room", MemberList: []GroupMember{{UserName: "@a"}}}
+	for i := 0; i < 2; i++ {
+		resp, err := w.GetContactList()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.ContactList) != 2 || len(resp.GroupMemberList) != 1 || len(w.PublicUserList) != 1 || w.MemberCount != 4 {
+			t.Fatalf("%d %+v %+v", i, resp, w.PublicUserList)
+		}
+	}
+	if fmt.Sprint(pages) != "[0 7 0 7]" {
+		t.Fatalf("%v", pages)
+	}
+	if len(w.GroupMemberList[0].MemberList) != 1 || w.MemberMap["@b"].NickName != "Bob" {
+		t.Fatalf("%+v", w.GroupMemberList)
+	}
+}
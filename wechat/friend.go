@@ -0,0 +1,170 @@
+package wechat
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// verify user opcode
+const (
+	VerifyOpcodeAccept = 3
+	VerifySceneAccept  = 33
+)
+
+// FriendRequest 好友请求
+type FriendRequest struct {
+	MsgID      string `json:"msgId"`
+	UserName   string `json:"userName"`
+	NickName   string `json:"nickName"`
+	Content    string `json:"content"`
+	Ticket     string `json:"ticket"`
+	Scene      int    `json:"scene"`
+	CreateTime int64  `json:"createTime"`
+	receivedAt time.Time
+}
+
+// FriendPolicy 好友请求的处理策略
+type FriendPolicy struct {
+	AutoAccept bool   `json:"autoAccept"`
+	Greeting   string `json:"greeting"`
+}
+
+// friendRequests 待处理的好友请求，按UserName去重
+type friendRequests struct {
+	pending map[string]*FriendRequest
+	policy  FriendPolicy
+	sync.RWMutex
+}
+
+// SetFriendPolicy 设置好友请求的自动通过策略，随登录信息一起保存
+func (w *Wechat) SetFriendPolicy(policy FriendPolicy) {
+	w.friends.Lock()
+	w.friends.policy = policy
+	w.friends.Unlock()
+	w.SaveSession()
+}
+
+// FriendPolicy 当前的好友请求策略
+func (w *Wechat) FriendPolicy() FriendPolicy {
+	w.friends.RLock()
+	defer w.friends.RUnlock()
+	return w.friends.policy
+}
+
+// FriendRequests 待处理的好友请求，按时间排序
+func (w *Wechat) FriendRequests() []*FriendRequest {
+	w.friends.RLock()
+	defer w.friends.RUnlock()
+	list := make([]*FriendRequest, 0, len(w.friends.pending))
+	for _, req := range w.friends.pending {
+		list = append(list, req)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreateTime < list[j].CreateTime
+	})
+	return list
+}
+
+// GetFriendRequest 按UserName查找待处理的好友请求
+func (w *Wechat) GetFriendRequest(userName string) (*FriendRequest, bool) {
+	w.friends.RLock()
+	defer w.friends.RUnlock()
+	req, ok := w.friends.pending[userName]
+	return req, ok
+}
+
+// AcceptFriend 通过好友请求
+func (w *Wechat) AcceptFriend(ctx context.Context, req *FriendRequest) error {
+	if !w.IsLogin() {
+		return fmt.Errorf("请重新登录")
+	}
+	if req == nil || req.UserName == "" || req.Ticket == "" {
+		return fmt.Errorf("好友请求不完整")
+	}
+	w.Log.Printf("%s AcceptFriend: userName=%s nickName=%s", w.GetUUID(), req.UserName, req.NickName)
+	wxurl := fmt.Sprintf("%s?r=%d&lang=zh_CN&pass_ticket=%s",
+		w.apiURL(WebWxVerifyUserPath), time.Now().Unix(), w.Request.BaseRequest.PassTicket)
+	params := map[string]interface{}{
+		"BaseRequest":        w.Request.BaseRequest,
+		"Opcode":             VerifyOpcodeAccept,
+		"VerifyUserListSize": 1,
+		"VerifyUserList": []map[string]string{{
+			"Value":            req.UserName,
+			"VerifyUserTicket": req.Ticket,
+		}},
+		"VerifyContent":  "",
+		"SceneListCount": 1,
+		"SceneList":      []int{VerifySceneAccept},
+		"skey":           w.Request.BaseRequest.Skey,
+	}
+	resp := new(InnerResponse)
+	if err := w.postJSON(ctx, wxurl, params, resp); err != nil {
+		w.Log.Printf("%s AcceptFriend faild: %s", w.GetUUID(), err.Error())
+		return err
+	}
+	if err := retError("通过好友请求失败", resp.BaseResponse); err != nil {
+		return err
+	}
+	w.friends.Lock()
+	delete(w.friends.pending, req.UserName)
+	w.friends.Unlock()
+	return nil
+}
+
+// handleFriendRequest 记录好友请求，开启自动通过时在后台通过并发送问候语
+func (w *Wechat) handleFriendRequest(ctx context.Context, msg *Message) {
+	req, err := msg.FriendRequest()
+	if err != nil {
+		w.Log.Printf("%s friend request ignored: %s", w.GetUUID(), err.Error())
+		return
+	}
+	req.receivedAt = time.Now()
+	w.friends.add(req)
+	policy := w.FriendPolicy()
+	if !policy.AutoAccept {
+		return
+	}
+	// 不阻塞消息同步，Run退出时随ctx取消
+	go w.autoAccept(ctx, req, policy.Greeting)
+}
+
+// autoAccept 通过好友请求并发送问候语
+func (w *Wechat) autoAccept(ctx context.Context, req *FriendRequest, greeting string) {
+	if err := w.AcceptFriend(ctx, req); err != nil {
+		w.Log.Printf("%s auto accept faild: %s", w.GetUUID(), err.Error())
+		return
+	}
+	if greeting == "" {
+		return
+	}
+	if _, err := w.SendText(ctx, req.UserName, greeting); err != nil {
+		w.Log.Printf("%s send greeting faild: %s", w.GetUUID(), err.Error())
+	}
+}
+
+// add 记录好友请求，去掉过期的，超过FriendRequestMax时丢弃最早的
+func (f *friendRequests) add(req *FriendRequest) {
+	f.Lock()
+	defer f.Unlock()
+	if f.pending == nil {
+		f.pending = map[string]*FriendRequest{}
+	}
+	f.pending[req.UserName] = req
+	for userName, pending := range f.pending {
+		if req.receivedAt.Sub(pending.receivedAt) > FriendRequestTTL {
+			delete(f.pending, userName)
+		}
+	}
+	for len(f.pending) > FriendRequestMax {
+		var oldest *FriendRequest
+		for _, pending := range f.pending {
+			if oldest == nil || pending.receivedAt.Before(oldest.receivedAt) {
+				oldest = pending
+			}
+		}
+		delete(f.pending, oldest.UserName)
+	}
+}
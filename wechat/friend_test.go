@@ -0,0 +1,112 @@
+package wechat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestFriendRequest(t *testing.T) {
+	var verify struct {
+		Opcode         int
+		VerifyUserList []struct {
+			Value            string
+			VerifyUserTicket string
+		}
+		SceneList []int
+	}
+	var greeting string
+	greeted := make(chan struct{}, 1)
+	w, server := newTestWechat(t, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case APIPath + WebWxVerifyUserPath:
+			json.NewDecoder(req.Body).Decode(&verify)
+			rw.Write([]byte(`{"BaseResponse":{"Ret":0,"ErrMsg":""}}`))
+		case APIPath + WebWxSendMsgPath:
+			params := struct {
+				Msg struct {
+					Content    string
+					ToUserName string
+				}
+			}{}
+			json.NewDecoder(req.Body).Decode(&params)
+			greeting = params.Msg.ToUserName + ":" + params.Msg.Content
+			greeted <- struct{}{}
+			rw.Write([]byte(`{"BaseResponse":{"Ret":0,"ErrMsg":""},"MsgID":"1","LocalID":"2"}`))
+		default:
+			http.NotFound(rw, req)
+		}
+	}))
+	defer server.Close()
+
+	verifyMsg := func(id, userName string) Message {
+		return Message{MsgID: id, MsgType: MsgTypeVerify, FromUserName: "fmessage", RecommendInfo: RecommendInfo{
+			UserName: userName, NickName: "nick" + id, Content: "hi, I'm " + id, Ticket: "ticket" + id, Scene: 30,
+		}}
+	}
+	w.handleSync(context.Background(), &SyncResp{AddMsgList: []Message{verifyMsg("1", "@stranger"), {MsgID: "2", MsgType: MsgTypeVerify}}})
+	pending := w.FriendRequests()
+	if len(pending) != 1 || pending[0].Ticket != "ticket1" || pending[0].Content != "hi, I'm 1" || pending[0].NickName != "nick1" {
+		t.Fatalf("%+v", pending)
+	}
+	if err := w.AcceptFriend(context.Background(), pending[0]); err != nil {
+		t.Fatal(err)
+	}
+	if verify.Opcode != VerifyOpcodeAccept || len(verify.VerifyUserList) != 1 ||
+		verify.VerifyUserList[0].Value != "@stranger" || verify.VerifyUserList[0].VerifyUserTicket != "ticket1" ||
+		len(verify.SceneList) != 1 || verify.SceneList[0] != VerifySceneAccept {
+		t.Fatalf("%+v", verify)
+	}
+	if len(w.FriendRequests()) != 0 || greeting != "" {
+		t.Fatalf("%+v %s", w.FriendRequests(), greeting)
+	}
+
+	w.SetFriendPolicy(FriendPolicy{AutoAccept: true, Greeting: "welcome"})
+	w.handleSync(context.Background(), &SyncResp{AddMsgList: []Message{verifyMsg("3", "@customer")}})
+	select {
+	case <-greeted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("auto accept not finished")
+	}
+	if verify.VerifyUserList[0].Value != "@customer" || greeting != "@customer:welcome" {
+		t.Fatalf("%+v %s", verify, greeting)
+	}
+	if _, ok := w.GetFriendRequest("@customer"); ok {
+		t.Fatal("auto accepted request still pending")
+	}
+}
+
+func TestFriendRequestLimit(t *testing.T) {
+	f := &friendRequests{}
+	start := time.Now()
+	f.add(&FriendRequest{UserName: "@old", receivedAt: start.Add(-FriendRequestTTL - time.Minute)})
+	for i := 0; i < FriendRequestMax+10; i++ {
+		f.add(&FriendRequest{UserName: fmt.Sprintf("@u%d", i), receivedAt: start.Add(time.Duration(i) * time.Second)})
+	}
+	if len(f.pending) != FriendRequestMax {
+		t.Fatalf("%d", len(f.pending))
+	}
+	if _, ok := f.pending["@old"]; ok {
+		t.Fatal("expired request kept")
+	}
+	if _, ok := f.pending["@u9"]; ok {
+		t.Fatal("oldest request kept")
+	}
+	if _, ok := f.pending["@u10"]; !ok {
+		t.Fatal("request dropped")
+	}
+}
+
+func TestFriendPolicySession(t *testing.T) {
+	w := NewWechat(GetLogger())
+	w.Request.BaseRequest.PassTicket = "ticket"
+	w.SetFriendPolicy(FriendPolicy{AutoAccept: true, Greeting: "welcome"})
+	restored := NewWechat(GetLogger())
+	restored.Restore(w.Session())
+	if p := restored.FriendPolicy(); !p.AutoAccept || p.Greeting != "welcome" {
+		t.Fatalf("%+v", p)
+	}
+}
@@ -2,6 +2,8 @@ package wechat
 
 import (
 	"bytes"
+	"encoding/xml"
+	"fmt"
 	"math/rand"
 	"os"
 	"strconv"
@@ -48,3 +50,22 @@ func getDeviceID() string {
 	deviceID := rnd.Int63n(1000000000000000)
 	return "e" + strconv.FormatInt(deviceID, 10)
 }
+
+// clientMsgID LocalID/ClientMsgId
+func clientMsgID() string {
+	return fmt.Sprintf("%d0%s", time.Now().Unix(), strconv.Itoa(rand.Int())[3:6])
+}
+
+// xmlEscape escape xml text
+func xmlEscape(s string) string {
+	buf := new(bytes.Buffer)
+	xml.EscapeText(buf, []byte(s))
+	return buf.String()
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
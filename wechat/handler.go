@@ -0,0 +1,197 @@
+package wechat
+
+import (
+	"regexp"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+// MessageHandler 消息处理
+type MessageHandler func(w *Wechat, msg *Message)
+
+// MessageFilter 消息过滤，全部返回true时才处理
+type MessageFilter func(msg *Message) bool
+
+// ContactHandler 联系人变更处理
+type ContactHandler func(w *Wechat, modList, delList []Member)
+
+// LoginHandler 登录成功，Restore恢复登录信息时也会调用
+type LoginHandler func(w *Wechat)
+
+// LogoutHandler 会话结束，err为LogoutError、ErrLogout或ctx取消的错误
+type LogoutHandler func(w *Wechat, err error)
+
+// UploadProgressHandler 上传进度
+type UploadProgressHandler func(w *Wechat, name string, sent, total int64)
+
+type messageHandler struct {
+	handler MessageHandler
+	filters []MessageFilter
+}
+
+// handlers 注册的事件处理
+type handlers struct {
+	message []messageHandler
+	contact []ContactHandler
+	login   []LoginHandler
+	logout  []LogoutHandler
+	upload  []UploadProgressHandler
+	sync.RWMutex
+}
+
+// OnMessage 注册消息处理
+func (w *Wechat) OnMessage(handler MessageHandler, filters ...MessageFilter) {
+	w.handlers.Lock()
+	defer w.handlers.Unlock()
+	w.handlers.message = append(w.handlers.message, messageHandler{handler: handler, filters: filters})
+}
+
+// OnContactChange 注册联系人变更处理
+func (w *Wechat) OnContactChange(handler ContactHandler) {
+	w.handlers.Lock()
+	defer w.handlers.Unlock()
+	w.handlers.contact = append(w.handlers.contact, handler)
+}
+
+// OnLogin 注册登录成功处理
+func (w *Wechat) OnLogin(handler LoginHandler) {
+	w.handlers.Lock()
+	defer w.handlers.Unlock()
+	w.handlers.login = append(w.handlers.login, handler)
+}
+
+// OnLogout 注册会话结束处理
+func (w *Wechat) OnLogout(handler LogoutHandler) {
+	w.handlers.Lock()
+	defer w.handlers.Unlock()
+	w.handlers.logout = append(w.handlers.logout, handler)
+}
+
+// OnUploadProgress 注册上传进度处理，每上传一个分片调用一次
+func (w *Wechat) OnUploadProgress(handler UploadProgressHandler) {
+	w.handlers.Lock()
+	defer w.handlers.Unlock()
+	w.handlers.upload = append(w.handlers.upload, handler)
+}
+
+// FilterMsgType 按消息类型过滤
+func FilterMsgType(types ...MsgType) MessageFilter {
+	return func(msg *Message) bool {
+		for _, t := range types {
+			if msg.MsgType == t {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// FilterFrom 按发送人过滤，群消息匹配群或群里的发送人
+func FilterFrom(userNames ...string) MessageFilter {
+	return func(msg *Message) bool {
+		sender, _ := msg.GroupContent()
+		for _, userName := range userNames {
+			if msg.FromUserName == userName || sender == userName {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// FilterGroup 只处理群消息
+func FilterGroup() MessageFilter {
+	return func(msg *Message) bool {
+		return msg.IsGroup()
+	}
+}
+
+// FilterPrivate 只处理私聊消息
+func FilterPrivate() MessageFilter {
+	return func(msg *Message) bool {
+		return !msg.IsGroup() && strings.HasPrefix(msg.FromUserName, "@")
+	}
+}
+
+// FilterContent 按内容正则过滤
+func FilterContent(re *regexp.Regexp) MessageFilter {
+	return func(msg *Message) bool {
+		return re.MatchString(msg.Text())
+	}
+}
+
+// emitMessage 分发消息
+func (w *Wechat) emitMessage(msg *Message) {
+	w.handlers.RLock()
+	hs := w.handlers.message
+	w.handlers.RUnlock()
+	for _, h := range hs {
+		matched := true
+		for _, filter := range h.filters {
+			if !filter(msg) {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		handler := h.handler
+		w.safeCall("OnMessage", func() { handler(w, msg) })
+	}
+}
+
+// emitContactChange 分发联系人变更
+func (w *Wechat) emitContactChange(modList, delList []Member) {
+	w.handlers.RLock()
+	hs := w.handlers.contact
+	w.handlers.RUnlock()
+	for _, handler := range hs {
+		handler := handler
+		w.safeCall("OnContactChange", func() { handler(w, modList, delList) })
+	}
+}
+
+// emitLogin 分发登录成功
+func (w *Wechat) emitLogin() {
+	w.handlers.RLock()
+	hs := w.handlers.login
+	w.handlers.RUnlock()
+	for _, handler := range hs {
+		handler := handler
+		w.safeCall("OnLogin", func() { handler(w) })
+	}
+}
+
+// emitLogout 分发会话结束
+func (w *Wechat) emitLogout(err error) {
+	w.handlers.RLock()
+	hs := w.handlers.logout
+	w.handlers.RUnlock()
+	for _, handler := range hs {
+		handler := handler
+		w.safeCall("OnLogout", func() { handler(w, err) })
+	}
+}
+
+// emitUploadProgress 分发上传进度
+func (w *Wechat) emitUploadProgress(name string, sent, total int64) {
+	w.handlers.RLock()
+	hs := w.handlers.upload
+	w.handlers.RUnlock()
+	for _, handler := range hs {
+		handler := handler
+		w.safeCall("OnUploadProgress", func() { handler(w, name, sent, total) })
+	}
+}
+
+// safeCall 处理函数panic不影响同步
+func (w *Wechat) safeCall(name string, fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			w.Log.Printf("%s %s panic: %v\n%s", w.GetUUID(), name, r, debug.Stack())
+		}
+	}()
+	fn()
+}
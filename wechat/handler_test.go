@@ -0,0 +1,76 @@
+package wechat
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"testing"
+)
+
+func TestEmitMessage(t *testing.T) {
+	w := NewWechat(GetLogger())
+	var private, group, panicked int
+	w.OnMessage(func(w *Wechat, msg *Message) {
+		panicked++
+		panic("buggy handler")
+	})
+	w.OnMessage(func(w *Wechat, msg *Message) {
+		private++
+	}, FilterPrivate(), FilterMsgType(MsgTypeText))
+	w.OnMessage(func(w *Wechat, msg *Message) {
+		group++
+	}, FilterGroup(), FilterFrom("@sender"), FilterContent(regexp.MustCompile(`^ping`)))
+
+	w.handleSync(context.Background(), &SyncResp{AddMsgList: []Message{
+		{MsgType: MsgTypeText, FromUserName: "@friend", ToUserName: "@self", Content: "hi"},
+		{MsgType: MsgTypeImage, FromUserName: "@friend", ToUserName: "@self"},
+		{MsgType: MsgTypeText, FromUserName: "@@group", ToUserName: "@self", Content: "@sender:<br/>ping"},
+		{MsgType: MsgTypeText, FromUserName: "@@group", ToUserName: "@self", Content: "@other:<br/>ping"},
+	}})
+	if panicked != 4 || private != 1 || group != 1 {
+		t.Fatalf("panicked=%d private=%d group=%d", panicked, private, group)
+	}
+}
+
+func TestEmitContactChange(t *testing.T) {
+	w := NewWechat(GetLogger())
+	var mod, del int
+	w.OnContactChange(func(w *Wechat, modList, delList []Member) {
+		mod += len(modList)
+		del += len(delList)
+	})
+	w.handleSync(context.Background(), &SyncResp{
+		ModContactList: []Member{{UserName: "@a"}, {UserName: "@b"}},
+		DelContactList: []Member{{UserName: "@c"}},
+	})
+	if mod != 2 || del != 1 {
+		t.Fatalf("mod=%d del=%d", mod, del)
+	}
+}
+
+func TestEmitLoginLogout(t *testing.T) {
+	w, server := newTestWechat(t, http.NotFoundHandler())
+	defer server.Close()
+	logins := 0
+	var logouts []error
+	w.OnLogin(func(w *Wechat) {
+		logins++
+	})
+	w.OnLogout(func(w *Wechat, err error) {
+		logouts = append(logouts, err)
+	})
+
+	w.Restore(w.Session())
+	if logins != 1 {
+		t.Fatalf("logins=%d", logins)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := w.Run(ctx); err != context.Canceled {
+		t.Fatalf("%v", err)
+	}
+	w.Logout(context.Background())
+	if len(logouts) != 2 || logouts[0] != context.Canceled || logouts[1] != ErrLogout {
+		t.Fatalf("%v", logouts)
+	}
+}
@@ -0,0 +1,83 @@
+package wechat
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Host 账号所在的协议域名
+type Host struct {
+	Login string `json:"login"` // 接口域名 wx.qq.com
+	File  string `json:"file"`  // 上传下载 file.wx.qq.com
+	Push  string `json:"push"`  // synccheck webpush.wx.qq.com
+}
+
+// knownHosts 登录跳转域名对应的文件、推送域名，按后缀匹配，越具体越靠前
+var knownHosts = []struct {
+	suffix string
+	host   Host
+}{
+	{SyncHostQQWX2, Host{Login: SyncHostQQWX2, File: "file." + SyncHostQQWX2, Push: SyncHostQQWebpush}},
+	{SyncHostQQWX8, Host{Login: SyncHostQQWX8, File: "file." + SyncHostQQWX8, Push: SyncHostQQWX8Webpush}},
+	{SyncHostWechatWeb2, Host{Login: SyncHostWechatWeb2, File: "file." + SyncHostWechatWeb2, Push: SyncHostWechatWeb2Webpush}},
+	{SyncHostWechat, Host{Login: "web." + SyncHostWechat, File: "file.web." + SyncHostWechat, Push: SyncHostWechatWebWebpush}},
+	{SyncHostQQ, Host{Login: "wx." + SyncHostQQ, File: "file.wx." + SyncHostQQ, Push: SyncHostQQWXWebpush}},
+}
+
+// hostFor 根据登录跳转的域名选择协议域名
+func hostFor(hostname string) Host {
+	for _, known := range knownHosts {
+		if hostname == known.suffix || strings.HasSuffix(hostname, "."+known.suffix) {
+			return known.host
+		}
+	}
+	return Host{
+		Login: hostname,
+		File:  "file." + hostname,
+		Push:  "webpush." + hostname,
+	}
+}
+
+// Host 当前账号的协议域名
+func (w *Wechat) Host() Host {
+	return w.host
+}
+
+// setHost 根据redirectedURL设置协议域名
+func (w *Wechat) setHost() {
+	redirected, err := url.Parse(w.redirectedURL)
+	if err != nil || redirected.Hostname() == "" {
+		w.Log.Printf("%s setHost faild: %v", w.GetUUID(), err)
+		return
+	}
+	w.host = hostFor(redirected.Hostname())
+	w.Log.Printf("%s setHost: %+v", w.GetUUID(), w.host)
+}
+
+// apiURL 接口地址
+func (w *Wechat) apiURL(path string) string {
+	return "https://" + w.host.Login + APIPath + path
+}
+
+// fileURL 上传下载地址
+func (w *Wechat) fileURL(path string) string {
+	return "https://" + w.host.File + APIPath + path
+}
+
+// pushURL synccheck地址
+func (w *Wechat) pushURL(path string) string {
+	return "https://" + w.host.Push + APIPath + path
+}
+
+// cookie 获取登录域名下的cookie
+func (w *Wechat) cookie(name string) string {
+	if w.Client.Jar == nil {
+		return ""
+	}
+	for _, c := range w.Client.Jar.Cookies(&url.URL{Scheme: "https", Host: w.host.Login, Path: "/"}) {
+		if c.Name == name {
+			return c.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,41 @@
+package wechat
+
+import "testing"
+
+func TestHostFor(t *testing.T) {
+	cases := map[string]Host{
+		"wx.qq.com":       {Login: "wx.qq.com", File: "file.wx.qq.com", Push: "webpush.wx.qq.com"},
+		"wx2.qq.com":      {Login: "wx2.qq.com", File: "file.wx2.qq.com", Push: "webpush.wx2.qq.com"},
+		"wx8.qq.com":      {Login: "wx8.qq.com", File: "file.wx8.qq.com", Push: "webpush.wx8.qq.com"},
+		"web.wechat.com":  {Login: "web.wechat.com", File: "file.web.wechat.com", Push: "webpush.web.wechat.com"},
+		"web2.wechat.com": {Login: "web2.wechat.com", File: "file.web2.wechat.com", Push: "webpush.web2.wechat.com"},
+		"example.com":     {Login: "example.com", File: "file.example.com", Push: "webpush.example.com"},
+	}
+	for hostname, want := range cases {
+		if v := hostFor(hostname); v != want {
+			t.Errorf("%s: %+v", hostname, v)
+		}
+	}
+}
+
+func TestSetHost(t *testing.T) {
+	w := NewWechat(GetLogger())
+	if v := w.apiURL(WebWxInitPath); v != "https://wx.qq.com/cgi-bin/mmwebwx-bin/webwxinit" {
+		t.Fatalf("%s", v)
+	}
+	w.redirectedURL = "https://wx2.qq.com/cgi-bin/mmwebwx-bin/webwxnewloginpage?ticket=A&uuid=B&lang=zh-CN&scan=1"
+	w.setHost()
+	if v := w.pushURL(WebSyncCheckPath); v != "https://webpush.wx2.qq.com/cgi-bin/mmwebwx-bin/synccheck" {
+		t.Fatalf("%s", v)
+	}
+	if v := w.fileURL(WebUploadMediaPath); v != "https://file.wx2.qq.com/cgi-bin/mmwebwx-bin/webwxuploadmedia" {
+		t.Fatalf("%s", v)
+	}
+}
+
+func TestDeprecatedURL(t *testing.T) {
+	if WebWxInitURL != "https://wx.qq.com/cgi-bin/mmwebwx-bin/webwxinit" ||
+		WebSendMediaURL != "https://wx.qq.com/cgi-bin/mmwebwx-bin/webwxsendmsgimg" {
+		t.Fatalf("%s %s", WebWxInitURL, WebSendMediaURL)
+	}
+}
@@ -0,0 +1,123 @@
+package wechat
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+
+	// 支持的图片格式
+	_ "image/gif"
+	_ "image/png"
+)
+
+// image process
+const (
+	DefaultImageQuality = 85
+	MaxImagePixels      = 50 * 1000 * 1000
+)
+
+// ImageOptions 上传前的图片处理
+type ImageOptions struct {
+	MaxWidth  int // 最大宽度，0不限制
+	MaxHeight int // 最大高度，0不限制
+	Quality   int // jpeg质量1-100，0使用DefaultImageQuality
+}
+
+// ProcessImage 解码png、jpeg、gif(第一帧)，等比缩小到MaxWidth*MaxHeight以内，
+// 重新编码为jpeg，exif等元数据不会保留；不支持的格式返回image.ErrFormat
+func ProcessImage(data []byte, opts ImageOptions) ([]byte, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width*config.Height > MaxImagePixels {
+		return nil, fmt.Errorf("图片太大: %dx%d", config.Width, config.Height)
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	// 透明部分填充白色
+	bounds := src.Bounds()
+	flat := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), src, bounds.Min, draw.Over)
+
+	width, height := fitSize(bounds.Dx(), bounds.Dy(), opts.MaxWidth, opts.MaxHeight)
+	dst := flat
+	if width != bounds.Dx() || height != bounds.Dy() {
+		dst = resizeBox(flat, width, height)
+	}
+
+	quality := opts.Quality
+	if quality <= 0 || quality > 100 {
+		quality = DefaultImageQuality
+	}
+	buf := new(bytes.Buffer)
+	if err = jpeg.Encode(buf, dst, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// fitSize 等比缩小到maxWidth*maxHeight以内，不放大
+func fitSize(width, height, maxWidth, maxHeight int) (int, int) {
+	w, h := float64(width), float64(height)
+	if maxWidth > 0 && w > float64(maxWidth) {
+		h = h * float64(maxWidth) / w
+		w = float64(maxWidth)
+	}
+	if maxHeight > 0 && h > float64(maxHeight) {
+		w = w * float64(maxHeight) / h
+		h = float64(maxHeight)
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	return int(w + 0.5), int(h + 0.5)
+}
+
+// resizeBox 区域平均缩小
+func resizeBox(src *image.RGBA, width, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	srcW, srcH := src.Bounds().Dx(), src.Bounds().Dy()
+	for y := 0; y < height; y++ {
+		y0 := y * srcH / height
+		y1 := (y + 1) * srcH / height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < width; x++ {
+			x0 := x * srcW / width
+			x1 := (x + 1) * srcW / width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				i := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += uint32(src.Pix[i])
+					g += uint32(src.Pix[i+1])
+					b += uint32(src.Pix[i+2])
+					a += uint32(src.Pix[i+3])
+					i += 4
+					n++
+				}
+			}
+			j := dst.PixOffset(x, y)
+			dst.Pix[j] = uint8(r / n)
+			dst.Pix[j+1] = uint8(g / n)
+			dst.Pix[j+2] = uint8(b / n)
+			dst.Pix[j+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
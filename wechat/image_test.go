@@ -0,0 +1,62 @@
+package wechat
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestProcessImage(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 400, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 400; x++ {
+			src.Set(x, y, color.NRGBA{R: 255, A: uint8(x % 256)})
+		}
+	}
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, src); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ProcessImage(buf.Bytes(), ImageOptions{MaxWidth: 100, MaxHeight: 100, Quality: 70})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 100 || b.Dy() != 50 {
+		t.Fatalf("%v", b)
+	}
+
+	// 小图不放大
+	data, err = ProcessImage(buf.Bytes(), ImageOptions{MaxWidth: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config, err := jpeg.DecodeConfig(bytes.NewReader(data)); err != nil || config.Width != 400 {
+		t.Fatalf("%+v %v", config, err)
+	}
+
+	if _, err := ProcessImage([]byte("%PDF-1.4"), ImageOptions{}); err != image.ErrFormat {
+		t.Fatalf("%v", err)
+	}
+}
+
+func TestFitSize(t *testing.T) {
+	cases := [][6]int{
+		{4000, 3000, 1280, 1280, 1280, 960},
+		{3000, 4000, 1280, 1280, 960, 1280},
+		{800, 600, 0, 300, 400, 300},
+		{800, 600, 0, 0, 800, 600},
+	}
+	for _, c := range cases {
+		if w, h := fitSize(c[0], c[1], c[2], c[3]); w != c[4] || h != c[5] {
+			t.Errorf("%v: %dx%d", c, w, h)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package wechat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ErrLogout 调用Logout退出
+var ErrLogout = errors.New("已退出登录")
+
+// Logout 退出网页版微信，停止同步并清除登录信息；还在等待扫码时取消登录
+func (w *Wechat) Logout(ctx context.Context) error {
+	w.mu.Lock()
+	loginCancel := w.loginCancel
+	w.mu.Unlock()
+	if loginCancel != nil {
+		w.Log.Printf("%s Logout cancel login", w.GetUUID())
+		loginCancel()
+	}
+	if !w.IsLogin() {
+		if loginCancel != nil {
+			return nil
+		}
+		return fmt.Errorf("未登录")
+	}
+	w.Log.Printf("%s Logout start", w.GetUUID())
+	err := w.webwxlogout(ctx)
+	if err != nil {
+		w.Log.Printf("%s webwxlogout faild: %s", w.GetUUID(), err.Error())
+	}
+
+	// 等Run退出后再清除，同步中会读取登录信息
+	w.mu.Lock()
+	cancel, done := w.cancel, w.runDone
+	if cancel != nil {
+		w.stopErr = ErrLogout
+	}
+	w.mu.Unlock()
+	if cancel != nil {
+		// Run退出时分发OnLogout
+		cancel()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	uin := w.Request.BaseRequest.Wxuin
+	w.clearCredentials()
+	w.Log.Printf("%s Logout success: uin=%d", w.GetUUID(), uin)
+	if cancel == nil {
+		w.emitLogout(ErrLogout)
+	}
+	return err
+}
+
+// clearCredentials 清除登录信息
+func (w *Wechat) clearCredentials() {
+	w.mu.Lock()
+	*w.Request.BaseRequest = BaseRequest{DeviceID: w.deviceID}
+	w.Response.SyncKey = SyncKey{}
+	w.SyncKeyStr = ""
+	w.unread = nil
+	w.contactsLoaded = false
+	if w.Client.Jar != nil {
+		w.Client.Jar, _ = cookiejar.New(nil)
+	}
+	w.mu.Unlock()
+	w.mediaCache.reset()
+}
+
+// webwxlogout 通知服务端退出
+func (w *Wechat) webwxlogout(ctx context.Context) error {
+	wxurl := fmt.Sprintf("%s?redirect=1&type=0&skey=%s",
+		w.apiURL(WebWxLogoutPath), url.QueryEscape(w.Request.BaseRequest.Skey))
+	form := url.Values{}
+	form.Set("sid", w.Request.BaseRequest.Wxsid)
+	form.Set("uin", strconv.FormatInt(w.Request.BaseRequest.Wxuin, 10))
+	req, err := http.NewRequest(http.MethodPost, wxurl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", UserAgent)
+	resp, err := w.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("webwxlogout: status code = %d", resp.StatusCode)
+	}
+	return nil
+}
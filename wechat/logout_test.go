@@ -0,0 +1,99 @@
+package wechat
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestLogout(t *testing.T) {
+	polling := make(chan struct{}, 1)
+	var logout *http.Request
+	w, server := newTestWechat(t, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case APIPath + WebSyncCheckPath:
+			select {
+			case polling <- struct{}{}:
+			default:
+			}
+			<-req.Context().Done()
+		case APIPath + WebWxLogoutPath:
+			req.ParseForm()
+			logout = req
+		default:
+			http.NotFound(rw, req)
+		}
+	}))
+	defer server.Close()
+	w.Request.BaseRequest.Wxsid = "sid"
+	w.Request.BaseRequest.Wxuin = 123456
+	var logoutErr error
+	w.OnLogout(func(w *Wechat, err error) {
+		logoutErr = err
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- w.Run(context.Background())
+	}()
+	<-polling
+	if err := w.Logout(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != ErrLogout || logoutErr != ErrLogout {
+			t.Fatalf("%v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("sync loop still running")
+	}
+	if logout == nil || logout.URL.Query().Get("skey") != "skey" || logout.URL.Query().Get("type") != "0" ||
+		logout.PostForm.Get("sid") != "sid" || logout.PostForm.Get("uin") != "123456" {
+		t.Fatalf("%+v", logout)
+	}
+	if w.IsLogin() || w.Request.BaseRequest.Skey != "" || w.Request.BaseRequest.Wxuin != 0 {
+		t.Fatalf("%+v", w.Request.BaseRequest)
+	}
+	if err := w.Logout(context.Background()); err == nil {
+		t.Fatal("logout twice")
+	}
+}
+
+func TestLogoutCancelLogin(t *testing.T) {
+	w, server := newTestWechat(t, http.NotFoundHandler())
+	defer server.Close()
+	w.Request.BaseRequest.PassTicket = ""
+
+	done := make(chan error, 1)
+	go func() {
+		done <- w.Login(context.Background())
+	}()
+	for i := 0; ; i++ {
+		w.mu.RLock()
+		waiting := w.loginCancel != nil
+		w.mu.RUnlock()
+		if waiting {
+			break
+		}
+		if i > 500 {
+			t.Fatal("login not started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := w.Logout(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err == nil || w.IsLogin() {
+			t.Fatalf("%v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("login not canceled")
+	}
+	if err := w.Run(context.Background()); err == nil {
+		t.Fatal("run without login")
+	}
+}
@@ -0,0 +1,106 @@
+package wechat
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// DownloadImage 下载图片、表情
+func (w *Wechat) DownloadImage(ctx context.Context, msg *Message, dst io.Writer) error {
+	params := url.Values{}
+	params.Set("MsgID", msg.MsgID)
+	params.Set("skey", w.Request.BaseRequest.Skey)
+	return w.download(ctx, w.apiURL(WebWxGetMsgImgPath)+"?"+params.Encode(), nil, dst)
+}
+
+// DownloadVoice 下载语音
+func (w *Wechat) DownloadVoice(ctx context.Context, msg *Message, dst io.Writer) error {
+	params := url.Values{}
+	params.Set("msgid", msg.MsgID)
+	params.Set("skey", w.Request.BaseRequest.Skey)
+	return w.download(ctx, w.apiURL(WebWxGetVoicePath)+"?"+params.Encode(), nil, dst)
+}
+
+// DownloadVideo 下载视频
+func (w *Wechat) DownloadVideo(ctx context.Context, msg *Message, dst io.Writer) error {
+	params := url.Values{}
+	params.Set("msgid", msg.MsgID)
+	params.Set("skey", w.Request.BaseRequest.Skey)
+	// 不带Range服务端不返回视频内容
+	header := http.Header{}
+	header.Set("Range", "bytes=0-")
+	return w.download(ctx, w.apiURL(WebWxGetVideoPath)+"?"+params.Encode(), header, dst)
+}
+
+// DownloadFile 下载文件
+func (w *Wechat) DownloadFile(ctx context.Context, msg *Message, dst io.Writer) error {
+	params := url.Values{}
+	params.Set("sender", msg.FromUserName)
+	params.Set("mediaid", msg.MediaID)
+	params.Set("encryfilename", msg.EncryFileName)
+	params.Set("fromuser", strconv.FormatInt(w.Request.BaseRequest.Wxuin, 10))
+	params.Set("pass_ticket", w.Request.BaseRequest.PassTicket)
+	params.Set("webwx_data_ticket", w.cookie("webwx_data_ticket"))
+	return w.download(ctx, w.fileURL(WebWxGetMediaPath)+"?"+params.Encode(), nil, dst)
+}
+
+// DownloadMedia 按消息类型下载
+func (w *Wechat) DownloadMedia(ctx context.Context, msg *Message, dst io.Writer) error {
+	switch msg.MsgType {
+	case MsgTypeImage, MsgTypeEmoticon:
+		return w.DownloadImage(ctx, msg, dst)
+	case MsgTypeVoice:
+		return w.DownloadVoice(ctx, msg, dst)
+	case MsgTypeVideo, MsgTypeMicroVideo:
+		return w.DownloadVideo(ctx, msg, dst)
+	case MsgTypeApp:
+		if msg.AppMsgType == AppMsgTypeAttach {
+			return w.DownloadFile(ctx, msg, dst)
+		}
+	}
+	return fmt.Errorf("消息没有可下载的内容: type=%d", msg.MsgType)
+}
+
+// download 带登录cookie下载
+func (w *Wechat) download(ctx context.Context, wxurl string, header http.Header, dst io.Writer) error {
+	if !w.IsLogin() {
+		return fmt.Errorf("请重新登录")
+	}
+	w.Log.Printf("%s download: %s", w.GetUUID(), wxurl)
+	req, err := http.NewRequest(http.MethodGet, wxurl, nil)
+	if err != nil {
+		return err
+	}
+	for key := range header {
+		req.Header.Set(key, header.Get(key))
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	resp, err := w.streamClient().Do(req.WithContext(ctx))
+	if err != nil {
+		w.Log.Printf("%s download faild: %s", w.GetUUID(), err.Error())
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		w.Log.Printf("%s download faild: status code = %d", w.GetUUID(), resp.StatusCode)
+		return fmt.Errorf("download: status code = %d", resp.StatusCode)
+	}
+	if resp.ContentLength == 0 {
+		return fmt.Errorf("download: empty content")
+	}
+	_, err = io.Copy(dst, resp.Body)
+	return err
+}
+
+// streamClient 下载视频、文件时不限制总时长，由调用方的ctx取消
+func (w *Wechat) streamClient() *http.Client {
+	return &http.Client{
+		Transport:     w.Client.Transport,
+		Jar:           w.Client.Jar,
+		CheckRedirect: w.Client.CheckRedirect,
+	}
+}
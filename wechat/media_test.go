@@ -0,0 +1,90 @@
+package wechat
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// newTestWechat 已登录并指向测试服务器的账号
+func newTestWechat(t *testing.T, handler http.Handler) (*Wechat, *httptest.Server) {
+	server := httptest.NewTLSServer(handler)
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWechat(GetLogger())
+	w.Client = server.Client()
+	w.Client.Jar, _ = cookiejar.New(nil)
+	w.host = Host{Login: serverURL.Host, File: serverURL.Host, Push: serverURL.Host}
+	w.uuID = "test"
+	w.Request.BaseRequest.Skey = "skey"
+	w.Request.BaseRequest.PassTicket = "ticket"
+	w.Response.BaseResponse = &BaseResponse{}
+	w.User.UserName = "@self"
+	return w, server
+}
+
+func TestDownloadMedia(t *testing.T) {
+	w, server := newTestWechat(t, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case APIPath + WebWxGetMsgImgPath:
+			rw.Write([]byte("img:" + req.URL.Query().Get("MsgID")))
+		case APIPath + WebWxGetVideoPath:
+			if req.Header.Get("Range") == "" {
+				rw.WriteHeader(http.StatusOK)
+				return
+			}
+			rw.WriteHeader(http.StatusPartialContent)
+			rw.Write([]byte("video:" + req.URL.Query().Get("msgid")))
+		default:
+			http.NotFound(rw, req)
+		}
+	}))
+	defer server.Close()
+
+	cases := map[*Message]string{
+		{MsgID: "1", MsgType: MsgTypeImage}: "img:1",
+		{MsgID: "2", MsgType: MsgTypeVideo}: "video:2",
+	}
+	for msg, want := range cases {
+		buf := new(bytes.Buffer)
+		if err := w.DownloadMedia(context.Background(), msg, buf); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != want {
+			t.Fatalf("%s", buf.String())
+		}
+	}
+	if err := w.DownloadMedia(context.Background(), &Message{MsgType: MsgTypeText}, new(bytes.Buffer)); err == nil {
+		t.Fatal("expect error for text message")
+	}
+	if err := w.DownloadVoice(context.Background(), &Message{MsgID: "3"}, new(bytes.Buffer)); err == nil {
+		t.Fatal("expect error for 404")
+	}
+}
+
+func TestDownloadWithoutClientTimeout(t *testing.T) {
+	w, server := newTestWechat(t, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte("part1,"))
+		rw.(http.Flusher).Flush()
+		time.Sleep(300 * time.Millisecond)
+		rw.Write([]byte("part2"))
+	}))
+	defer server.Close()
+	w.Client.Timeout = 100 * time.Millisecond
+
+	buf := new(bytes.Buffer)
+	msg := &Message{MsgID: "1", MsgType: MsgTypeApp, AppMsgType: AppMsgTypeAttach, FileName: "a.zip", MediaID: "@media"}
+	if err := w.DownloadMedia(context.Background(), msg, buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "part1,part2" {
+		t.Fatalf("%s", buf.String())
+	}
+}
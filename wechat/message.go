@@ -0,0 +1,395 @@
+package wechat
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html"
+	"strings"
+	"sync"
+)
+
+// MsgType 消息类型
+type MsgType int
+
+// msg type
+const (
+	MsgTypeText           MsgType = 1     // 文本
+	MsgTypeImage          MsgType = 3     // 图片
+	MsgTypeVoice          MsgType = 34    // 语音
+	MsgTypeVerify         MsgType = 37    // 好友请求
+	MsgTypePossibleFriend MsgType = 40    // 可能认识的人
+	MsgTypeCard           MsgType = 42    // 名片
+	MsgTypeVideo          MsgType = 43    // 视频
+	MsgTypeEmoticon       MsgType = 47    // 表情
+	MsgTypeLocation       MsgType = 48    // 位置
+	MsgTypeApp            MsgType = 49    // 链接、文件等app消息
+	MsgTypeVoip           MsgType = 50    // 语音通话
+	MsgTypeStatusNotify   MsgType = 51    // 状态通知
+	MsgTypeMicroVideo     MsgType = 62    // 小视频
+	MsgTypeSys            MsgType = 10000 // 系统消息
+	MsgTypeRevoke         MsgType = 10002 // 撤回
+)
+
+// app msg type
+const (
+	AppMsgTypeText   = 1
+	AppMsgTypeImg    = 2
+	AppMsgTypeAudio  = 3
+	AppMsgTypeVideo  = 4
+	AppMsgTypeURL    = 5
+	AppMsgTypeAttach = 6
+	AppMsgTypeOpen   = 7
+	AppMsgTypeEmoji  = 8
+)
+
+// Message 收到的消息
+type Message struct {
+	MsgID                string        `json:"MsgId"`
+	NewMsgID             int64         `json:"NewMsgId"`
+	FromUserName         string        `json:"FromUserName"`
+	ToUserName           string        `json:"ToUserName"`
+	MsgType              MsgType       `json:"MsgType"`
+	SubMsgType           int           `json:"SubMsgType"`
+	AppMsgType           int           `json:"AppMsgType"`
+	Content              string        `json:"Content"`
+	OriContent           string        `json:"OriContent"`
+	Status               int           `json:"Status"`
+	ImgStatus            int           `json:"ImgStatus"`
+	ImgHeight            int           `json:"ImgHeight"`
+	ImgWidth             int           `json:"ImgWidth"`
+	CreateTime           int64         `json:"CreateTime"`
+	VoiceLength          int           `json:"VoiceLength"`
+	PlayLength           int           `json:"PlayLength"`
+	FileName             string        `json:"FileName"`
+	FileSize             string        `json:"FileSize"`
+	MediaID              string        `json:"MediaId"`
+	EncryFileName        string        `json:"EncryFileName"`
+	URL                  string        `json:"Url"`
+	StatusNotifyCode     int           `json:"StatusNotifyCode"`
+	StatusNotifyUserName string        `json:"StatusNotifyUserName"`
+	RecommendInfo        RecommendInfo `json:"RecommendInfo"`
+	AppInfo              AppInfo       `json:"AppInfo"`
+	ForwardFlag          int           `json:"ForwardFlag"`
+	HasProductID         int           `json:"HasProductId"`
+	Ticket               string        `json:"Ticket"`
+}
+
+// RecommendInfo 名片、好友请求中的用户信息
+type RecommendInfo struct {
+	UserName   string `json:"UserName"`
+	NickName   string `json:"NickName"`
+	QQNum      int64  `json:"QQNum"`
+	Province   string `json:"Province"`
+	City       string `json:"City"`
+	Content    string `json:"Content"`
+	Signature  string `json:"Signature"`
+	Alias      string `json:"Alias"`
+	Scene      int    `json:"Scene"`
+	VerifyFlag int    `json:"VerifyFlag"`
+	AttrStatus int64  `json:"AttrStatus"`
+	Sex        int    `json:"Sex"`
+	Ticket     string `json:"Ticket"`
+	OpCode     int    `json:"OpCode"`
+}
+
+// AppInfo AppInfo
+type AppInfo struct {
+	AppID string `json:"AppID"`
+	Type  int    `json:"Type"`
+}
+
+// Location 位置消息
+type Location struct {
+	X       float64 `xml:"x,attr"`
+	Y       float64 `xml:"y,attr"`
+	Scale   int     `xml:"scale,attr"`
+	Label   string  `xml:"label,attr"`
+	PoiName string  `xml:"poiname,attr"`
+}
+
+// AppMsg 链接、文件消息
+type AppMsg struct {
+	Title     string `xml:"title"`
+	Des       string `xml:"des"`
+	Type      int    `xml:"type"`
+	URL       string `xml:"url"`
+	AppAttach struct {
+		TotalLen int64  `xml:"totallen"`
+		AttachID string `xml:"attachid"`
+		FileExt  string `xml:"fileext"`
+	} `xml:"appattach"`
+}
+
+// Emoticon 表情消息
+type Emoticon struct {
+	MD5    string `xml:"md5,attr"`
+	Len    int64  `xml:"len,attr"`
+	Type   int    `xml:"type,attr"`
+	CDNURL string `xml:"cdnurl,attr"`
+	Width  int    `xml:"width,attr"`
+	Height int    `xml:"height,attr"`
+}
+
+// Image 图片消息，内容用DownloadImage下载
+type Image struct {
+	MsgID  string `xml:"-"`
+	Width  int    `xml:"-"`
+	Height int    `xml:"-"`
+	Length int64  `xml:"length,attr"`
+	MD5    string `xml:"md5,attr"`
+}
+
+// Voice 语音消息，内容用DownloadVoice下载
+type Voice struct {
+	MsgID    string `xml:"-"`
+	Duration int    `xml:"-"` // 毫秒
+	Length   int64  `xml:"length,attr"`
+}
+
+// Video 视频、小视频消息，内容用DownloadVideo下载
+type Video struct {
+	MsgID      string `xml:"-"`
+	Width      int    `xml:"-"`
+	Height     int    `xml:"-"`
+	PlayLength int    `xml:"-"` // 秒
+	Length     int64  `xml:"length,attr"`
+	Micro      bool   `xml:"-"`
+}
+
+// Revoke 撤回消息
+type Revoke struct {
+	Session    string `xml:"session"`
+	OldMsgID   string `xml:"oldmsgid"`
+	MsgID      string `xml:"msgid"`
+	ReplaceMsg string `xml:"replacemsg"`
+}
+
+// IsGroup 是否群消息
+func (m *Message) IsGroup() bool {
+	return strings.HasPrefix(m.FromUserName, "@@") || strings.HasPrefix(m.ToUserName, "@@")
+}
+
+// GroupContent 拆分群消息的发送人和内容 "@xxx:<br/>content"
+func (m *Message) GroupContent() (sender, content string) {
+	if !strings.HasPrefix(m.FromUserName, "@@") {
+		return "", m.Content
+	}
+	i := strings.Index(m.Content, ":<br/>")
+	if i == -1 {
+		return "", m.Content
+	}
+	return m.Content[:i], m.Content[i+len(":<br/>"):]
+}
+
+// Text 文本内容，群消息去掉发送人
+func (m *Message) Text() string {
+	_, content := m.GroupContent()
+	return html.UnescapeString(strings.Replace(content, "<br/>", "\n", -1))
+}
+
+// IsMedia 是否图片、语音、视频、文件等可以下载的消息
+func (m *Message) IsMedia() bool {
+	switch m.MsgType {
+	case MsgTypeImage, MsgTypeVoice, MsgTypeVideo, MsgTypeMicroVideo:
+		return true
+	case MsgTypeApp:
+		return m.AppMsgType == AppMsgTypeAttach
+	}
+	return false
+}
+
+// IsSystem 是否系统消息
+func (m *Message) IsSystem() bool {
+	return m.MsgType == MsgTypeSys
+}
+
+// Image 图片，xml中的大小、md5解析失败时为空
+func (m *Message) Image() (*Image, error) {
+	if m.MsgType != MsgTypeImage {
+		return nil, fmt.Errorf("not an image message: %d", m.MsgType)
+	}
+	v := struct {
+		Img Image `xml:"img"`
+	}{}
+	m.decodeXML(m.Content, &v)
+	img := &v.Img
+	img.MsgID = m.MsgID
+	img.Width = m.ImgWidth
+	img.Height = m.ImgHeight
+	return img, nil
+}
+
+// Voice 语音
+func (m *Message) Voice() (*Voice, error) {
+	if m.MsgType != MsgTypeVoice {
+		return nil, fmt.Errorf("not a voice message: %d", m.MsgType)
+	}
+	v := struct {
+		Voice Voice `xml:"voicemsg"`
+	}{}
+	m.decodeXML(m.Content, &v)
+	voice := &v.Voice
+	voice.MsgID = m.MsgID
+	voice.Duration = m.VoiceLength
+	return voice, nil
+}
+
+// Video 视频、小视频
+func (m *Message) Video() (*Video, error) {
+	if m.MsgType != MsgTypeVideo && m.MsgType != MsgTypeMicroVideo {
+		return nil, fmt.Errorf("not a video message: %d", m.MsgType)
+	}
+	v := struct {
+		Video Video `xml:"videomsg"`
+	}{}
+	m.decodeXML(m.Content, &v)
+	video := &v.Video
+	video.MsgID = m.MsgID
+	video.Width = m.ImgWidth
+	video.Height = m.ImgHeight
+	video.PlayLength = m.PlayLength
+	video.Micro = m.MsgType == MsgTypeMicroVideo
+	return video, nil
+}
+
+// System 系统消息的文本，如加好友、入群提示
+func (m *Message) System() (string, error) {
+	if m.MsgType != MsgTypeSys {
+		return "", fmt.Errorf("not a system message: %d", m.MsgType)
+	}
+	return m.Text(), nil
+}
+
+// Card 名片
+func (m *Message) Card() (*RecommendInfo, error) {
+	if m.MsgType != MsgTypeCard {
+		return nil, fmt.Errorf("not a card message: %d", m.MsgType)
+	}
+	return &m.RecommendInfo, nil
+}
+
+// FriendRequest 好友请求
+func (m *Message) FriendRequest() (*FriendRequest, error) {
+	if m.MsgType != MsgTypeVerify {
+		return nil, fmt.Errorf("not a friend request message: %d", m.MsgType)
+	}
+	info := m.RecommendInfo
+	if info.UserName == "" || info.Ticket == "" {
+		return nil, fmt.Errorf("friend request without ticket: %s", m.MsgID)
+	}
+	return &FriendRequest{
+		MsgID:      m.MsgID,
+		UserName:   info.UserName,
+		NickName:   info.NickName,
+		Content:    info.Content,
+		Ticket:     info.Ticket,
+		Scene:      info.Scene,
+		CreateTime: m.CreateTime,
+	}, nil
+}
+
+// Location 位置
+func (m *Message) Location() (*Location, error) {
+	if m.MsgType != MsgTypeLocation {
+		return nil, fmt.Errorf("not a location message: %d", m.MsgType)
+	}
+	v := struct {
+		Location Location `xml:"location"`
+	}{}
+	if err := m.decodeXML(m.OriContent, &v); err != nil {
+		return nil, err
+	}
+	return &v.Location, nil
+}
+
+// AppMsg 链接、文件
+func (m *Message) AppMsg() (*AppMsg, error) {
+	if m.MsgType != MsgTypeApp {
+		return nil, fmt.Errorf("not an app message: %d", m.MsgType)
+	}
+	v := struct {
+		AppMsg AppMsg `xml:"appmsg"`
+	}{}
+	if err := m.decodeXML(m.Content, &v); err != nil {
+		return nil, err
+	}
+	return &v.AppMsg, nil
+}
+
+// Emoticon 表情
+func (m *Message) Emoticon() (*Emoticon, error) {
+	if m.MsgType != MsgTypeEmoticon {
+		return nil, fmt.Errorf("not an emoticon message: %d", m.MsgType)
+	}
+	v := struct {
+		Emoji Emoticon `xml:"emoji"`
+	}{}
+	if err := m.decodeXML(m.Content, &v); err != nil {
+		return nil, err
+	}
+	return &v.Emoji, nil
+}
+
+// Revoke 撤回
+func (m *Message) Revoke() (*Revoke, error) {
+	if m.MsgType != MsgTypeRevoke {
+		return nil, fmt.Errorf("not a revoke message: %d", m.MsgType)
+	}
+	v := struct {
+		Revoke Revoke `xml:"revokemsg"`
+	}{}
+	if err := m.decodeXML(m.Content, &v); err != nil {
+		return nil, err
+	}
+	return &v.Revoke, nil
+}
+
+// decodeXML 解析转义过的xml内容
+func (m *Message) decodeXML(content string, v interface{}) error {
+	if strings.HasPrefix(m.FromUserName, "@@") {
+		if i := strings.Index(content, ":<br/>"); i != -1 {
+			content = content[i+len(":<br/>"):]
+		}
+	}
+	content = html.UnescapeString(strings.Replace(content, "<br/>", "", -1))
+	if content == "" {
+		return fmt.Errorf("empty xml content")
+	}
+	return xml.Unmarshal([]byte(content), v)
+}
+
+// messageCache 最近收到的消息，供下载等按MsgId查找
+type messageCache struct {
+	ids  []string
+	msgs map[string]*Message
+	sync.RWMutex
+}
+
+func (c *messageCache) add(msg *Message) {
+	c.Lock()
+	defer c.Unlock()
+	if c.msgs == nil {
+		c.msgs = map[string]*Message{}
+	}
+	if _, ok := c.msgs[msg.MsgID]; ok {
+		return
+	}
+	c.ids = append(c.ids, msg.MsgID)
+	c.msgs[msg.MsgID] = msg
+	if len(c.ids) > MessageCacheSize {
+		delete(c.msgs, c.ids[0])
+		c.ids = c.ids[1:]
+	}
+}
+
+func (c *messageCache) get(msgID string) (*Message, bool) {
+	c.RLock()
+	defer c.RUnlock()
+	msg, ok := c.msgs[msgID]
+	return msg, ok
+}
+
+// GetMessage 按MsgId查找最近收到的消息
+func (w *Wechat) GetMessage(msgID string) (*Message, bool) {
+	return w.messages.get(msgID)
+}
@@ -0,0 +1,120 @@
+package wechat
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMessageGroupText(t *testing.T) {
+	msg := &Message{
+		MsgType:      MsgTypeText,
+		FromUserName: "@@group",
+		ToUserName:   "@self",
+		Content:      "@sender:<br/>hello&amp;world",
+	}
+	if !msg.IsGroup() {
+		t.Fatalf("%+v", msg)
+	}
+	if sender, _ := msg.GroupContent(); sender != "@sender" {
+		t.Fatalf("%s", sender)
+	}
+	if v := msg.Text(); v != "hello&world" {
+		t.Fatalf("%s", v)
+	}
+}
+
+func TestMessageDecode(t *testing.T) {
+	data := `{"AddMsgList":[
+	{"MsgId":"1001","MsgType":48,"FromUserName":"@a","ToUserName":"@b",
+	"Content":"北京:<br/>/cgi-bin/mmwebwx-bin/webwxgetpubliclinkimg?url=xxx",
+	"OriContent":"&lt;?xml version=\"1.0\"?&gt;&lt;msg&gt;&lt;location x=\"39.9\" y=\"116.3\" scale=\"16\" label=\"北京\" poiname=\"天安门\" /&gt;&lt;/msg&gt;"},
+	{"MsgId":"1002","MsgType":49,"AppMsgType":6,"FromUserName":"@a","ToUserName":"@b",
+	"Content":"&lt;msg&gt;&lt;appmsg appid=\"\"&gt;&lt;title&gt;report.pdf&lt;/title&gt;&lt;type&gt;6&lt;/type&gt;&lt;appattach&gt;&lt;totallen&gt;1024&lt;/totallen&gt;&lt;fileext&gt;pdf&lt;/fileext&gt;&lt;/appattach&gt;&lt;/appmsg&gt;&lt;/msg&gt;"},
+	{"MsgId":"1003","MsgType":10002,"FromUserName":"@@g","ToUserName":"@b",
+	"Content":"@a:<br/>&lt;sysmsg type=\"revokemsg\"&gt;&lt;revokemsg&gt;&lt;session&gt;@@g&lt;/session&gt;&lt;oldmsgid&gt;1&lt;/oldmsgid&gt;&lt;msgid&gt;999&lt;/msgid&gt;&lt;replacemsg&gt;&lt;![CDATA[\"a\" 撤回了一条消息]]&gt;&lt;/replacemsg&gt;&lt;/revokemsg&gt;&lt;/sysmsg&gt;"}
+	]}`
+	syncResp := new(SyncResp)
+	if err := json.Unmarshal([]byte(data), syncResp); err != nil {
+		t.Fatal(err)
+	}
+	if len(syncResp.AddMsgList) != 3 {
+		t.Fatalf("%+v", syncResp.AddMsgList)
+	}
+
+	location, err := syncResp.AddMsgList[0].Location()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location.X != 39.9 || location.PoiName != "天安门" {
+		t.Fatalf("%+v", location)
+	}
+
+	appMsg, err := syncResp.AddMsgList[1].AppMsg()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if appMsg.Title != "report.pdf" || appMsg.AppAttach.TotalLen != 1024 || appMsg.AppAttach.FileExt != "pdf" {
+		t.Fatalf("%+v", appMsg)
+	}
+
+	revoke, err := syncResp.AddMsgList[2].Revoke()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoke.MsgID != "999" || revoke.ReplaceMsg != `"a" 撤回了一条消息` {
+		t.Fatalf("%+v", revoke)
+	}
+
+	if _, err := syncResp.AddMsgList[0].AppMsg(); err == nil {
+		t.Fatal("expect error for wrong msg type")
+	}
+}
+
+func TestMessageMedia(t *testing.T) {
+	data := `{"AddMsgList":[
+	{"MsgId":"2001","MsgType":3,"FromUserName":"@a","ToUserName":"@b","ImgWidth":640,"ImgHeight":480,
+	"Content":"&lt;?xml version=\"1.0\"?&gt;&lt;msg&gt;&lt;img length=\"38214\" md5=\"abc\" cdnthumbwidth=\"67\" /&gt;&lt;/msg&gt;"},
+	{"MsgId":"2002","MsgType":34,"FromUserName":"@@g","ToUserName":"@b","VoiceLength":2000,
+	"Content":"@a:<br/>&lt;msg&gt;&lt;voicemsg endflag=\"1\" length=\"5389\" voicelength=\"2000\" /&gt;&lt;/msg&gt;"},
+	{"MsgId":"2003","MsgType":62,"FromUserName":"@a","ToUserName":"@b","PlayLength":5,"ImgWidth":224,"ImgHeight":400,
+	"Content":"&lt;msg&gt;&lt;videomsg length=\"523456\" playlength=\"5\" /&gt;&lt;/msg&gt;"},
+	{"MsgId":"2004","MsgType":10000,"FromUserName":"@a","ToUserName":"@b","Content":"你已添加了Alice，现在可以开始聊天了。"},
+	{"MsgId":"2005","MsgType":43,"FromUserName":"@a","ToUserName":"@b","PlayLength":12,"Content":""}
+	]}`
+	syncResp := new(SyncResp)
+	if err := json.Unmarshal([]byte(data), syncResp); err != nil {
+		t.Fatal(err)
+	}
+	msgs := syncResp.AddMsgList
+
+	img, err := msgs[0].Image()
+	if err != nil || img.MsgID != "2001" || img.Width != 640 || img.Height != 480 || img.Length != 38214 || img.MD5 != "abc" {
+		t.Fatalf("%+v %v", img, err)
+	}
+	voice, err := msgs[1].Voice()
+	if err != nil || voice.Duration != 2000 || voice.Length != 5389 {
+		t.Fatalf("%+v %v", voice, err)
+	}
+	video, err := msgs[2].Video()
+	if err != nil || !video.Micro || video.PlayLength != 5 || video.Length != 523456 || video.Width != 224 {
+		t.Fatalf("%+v %v", video, err)
+	}
+	if text, err := msgs[3].System(); err != nil || text != "你已添加了Alice，现在可以开始聊天了。" || !msgs[3].IsSystem() {
+		t.Fatalf("%s %v", text, err)
+	}
+	if video, err := msgs[4].Video(); err != nil || video.Micro || video.PlayLength != 12 || video.Length != 0 {
+		t.Fatalf("%+v %v", video, err)
+	}
+
+	for i, media := range []bool{true, true, true, false, true} {
+		if msgs[i].IsMedia() != media {
+			t.Fatalf("%s: IsMedia=%v", msgs[i].MsgID, !media)
+		}
+	}
+	if _, err := msgs[3].Image(); err == nil {
+		t.Fatal("system message decoded as image")
+	}
+	if _, err := msgs[0].Voice(); err == nil {
+		t.Fatal("image decoded as voice")
+	}
+}
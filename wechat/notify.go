@@ -0,0 +1,83 @@
+package wechat
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// status notify code
+const (
+	StatusNotifyCodeRead         = 1
+	StatusNotifyCodeEnterSession = 2
+	StatusNotifyCodeInited       = 3
+	StatusNotifyCodeSyncConv     = 4
+	StatusNotifyCodeQuitSession  = 5
+)
+
+// MarkRead 标记会话已读，手机上的未读数会同步清除
+func (w *Wechat) MarkRead(ctx context.Context, userName string) error {
+	if userName == "" {
+		return fmt.Errorf("联系人不能为空")
+	}
+	if err := w.statusNotify(ctx, StatusNotifyCodeRead, userName); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	delete(w.unread, userName)
+	w.mu.Unlock()
+	return nil
+}
+
+// Unread 各会话的未读数
+func (w *Wechat) Unread() map[string]int {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	unread := make(map[string]int, len(w.unread))
+	for userName, count := range w.unread {
+		unread[userName] = count
+	}
+	return unread
+}
+
+// statusNotify webwxstatusnotify
+func (w *Wechat) statusNotify(ctx context.Context, code int, toUserName string) error {
+	if !w.IsLogin() {
+		return fmt.Errorf("请重新登录")
+	}
+	w.Log.Printf("%s statusNotify: code=%d to=%s", w.GetUUID(), code, toUserName)
+	wxurl := fmt.Sprintf("%s?lang=zh_CN&pass_ticket=%s", w.apiURL(WebWxStatusNotifyPath), w.Request.BaseRequest.PassTicket)
+	params := map[string]interface{}{
+		"BaseRequest":  w.Request.BaseRequest,
+		"Code":         code,
+		"FromUserName": w.User.UserName,
+		"ToUserName":   toUserName,
+		"ClientMsgId":  time.Now().UnixNano() / int64(time.Millisecond),
+	}
+	resp := new(InnerResponse)
+	if err := w.postJSON(ctx, wxurl, params, resp); err != nil {
+		w.Log.Printf("%s statusNotify faild: %s", w.GetUUID(), err.Error())
+		return err
+	}
+	return retError("状态通知失败", resp.BaseResponse)
+}
+
+// countUnread 累加收到的消息，自己在手机上发消息或读过的会话清零
+func (w *Wechat) countUnread(msg *Message) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.unread == nil {
+		w.unread = map[string]int{}
+	}
+	switch {
+	case msg.MsgType == MsgTypeStatusNotify:
+		if msg.StatusNotifyCode == StatusNotifyCodeRead || msg.StatusNotifyCode == StatusNotifyCodeEnterSession {
+			delete(w.unread, msg.ToUserName)
+		}
+	case msg.FromUserName == w.User.UserName:
+		delete(w.unread, msg.ToUserName)
+	case msg.MsgType == MsgTypeSys || msg.MsgType == MsgTypeVerify:
+	default:
+		w.unread[msg.FromUserName]++
+	}
+}
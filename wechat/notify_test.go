@@ -0,0 +1,49 @@
+package wechat
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestMarkRead(t *testing.T) {
+	var notify struct {
+		Code         int
+		FromUserName string
+		ToUserName   string
+	}
+	w, server := newTestWechat(t, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != APIPath+WebWxStatusNotifyPath {
+			http.NotFound(rw, req)
+			return
+		}
+		json.NewDecoder(req.Body).Decode(&notify)
+		rw.Write([]byte(`{"BaseResponse":{"Ret":0,"ErrMsg":""},"MsgID":"1"}`))
+	}))
+	defer server.Close()
+
+	w.handleSync(context.Background(), &SyncResp{AddMsgList: []Message{
+		{MsgID: "1", MsgType: MsgTypeText, FromUserName: "@a", ToUserName: "@self"},
+		{MsgID: "2", MsgType: MsgTypeText, FromUserName: "@a", ToUserName: "@self"},
+		{MsgID: "3", MsgType: MsgTypeImage, FromUserName: "@@room", ToUserName: "@self"},
+		{MsgID: "4", MsgType: MsgTypeText, FromUserName: "@b", ToUserName: "@self"},
+		{MsgID: "5", MsgType: MsgTypeText, FromUserName: "@self", ToUserName: "@b"},
+		{MsgID: "6", MsgType: MsgTypeText, FromUserName: "@c", ToUserName: "@self"},
+		{MsgID: "7", MsgType: MsgTypeStatusNotify, StatusNotifyCode: StatusNotifyCodeRead, FromUserName: "@self", ToUserName: "@c"},
+	}})
+	unread := w.Unread()
+	if len(unread) != 2 || unread["@a"] != 2 || unread["@@room"] != 1 {
+		t.Fatalf("%v", unread)
+	}
+
+	if err := w.MarkRead(context.Background(), "@a"); err != nil {
+		t.Fatal(err)
+	}
+	if notify.Code != StatusNotifyCodeRead || notify.FromUserName != "@self" || notify.ToUserName != "@a" {
+		t.Fatalf("%+v", notify)
+	}
+	if unread := w.Unread(); len(unread) != 1 || unread["@@room"] != 1 {
+		t.Fatalf("%v", unread)
+	}
+}
@@ -0,0 +1,108 @@
+package wechat
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// 收件人选择器前缀，不带前缀时依次按备注、微信号、昵称/群名匹配
+const (
+	SelectorRemark = "remark:"
+	SelectorAlias  = "alias:"
+	SelectorNick   = "nick:"
+	SelectorGroup  = "group:"
+)
+
+// AmbiguousError 选择器匹配到多个联系人
+type AmbiguousError struct {
+	Selector  string
+	UserNames []string
+}
+
+func (e *AmbiguousError) Error() string {
+	return fmt.Sprintf("联系人不唯一: %s 匹配到%d个 %s", e.Selector, len(e.UserNames), strings.Join(e.UserNames, ","))
+}
+
+// ResolveRecipient 把备注、昵称、微信号或群名解析成本次登录的UserName，@开头的直接返回
+func (w *Wechat) ResolveRecipient(selector string) (string, error) {
+	selector = strings.TrimSpace(selector)
+	if selector == "" {
+		return "", fmt.Errorf("联系人不能为空")
+	}
+	if strings.HasPrefix(selector, "@") {
+		return selector, nil
+	}
+
+	remark := recipientRule{field: func(m Member) string { return m.RemarkName }}
+	alias := recipientRule{field: func(m Member) string { return m.Alias }}
+	nick := recipientRule{field: func(m Member) string { return m.NickName }}
+	topic := recipientRule{field: func(m Member) string { return m.NickName }, group: true}
+	rules := []recipientRule{remark, alias, nick}
+	name := selector
+	switch {
+	case strings.HasPrefix(selector, SelectorRemark):
+		rules, name = []recipientRule{remark}, strings.TrimPrefix(selector, SelectorRemark)
+	case strings.HasPrefix(selector, SelectorAlias):
+		rules, name = []recipientRule{alias}, strings.TrimPrefix(selector, SelectorAlias)
+	case strings.HasPrefix(selector, SelectorNick):
+		rules, name = []recipientRule{nick}, strings.TrimPrefix(selector, SelectorNick)
+	case strings.HasPrefix(selector, SelectorGroup):
+		rules, name = []recipientRule{topic}, strings.TrimPrefix(selector, SelectorGroup)
+	}
+	if name = strings.TrimSpace(name); name == "" {
+		return "", fmt.Errorf("联系人不能为空")
+	}
+
+	userName, err := w.matchRecipient(selector, name, rules)
+	if _, ambiguous := err.(*AmbiguousError); err == nil || ambiguous {
+		return userName, err
+	}
+	// 重新登录后UserName都变了，还没有联系人时先获取
+	w.mu.RLock()
+	loaded := w.contactsLoaded
+	w.mu.RUnlock()
+	if loaded {
+		return "", err
+	}
+	if loadErr := w.loadContacts(); loadErr != nil {
+		return "", fmt.Errorf("获取联系人失败: %s", loadErr.Error())
+	}
+	return w.matchRecipient(selector, name, rules)
+}
+
+// recipientRule 按字段匹配联系人
+type recipientRule struct {
+	field func(m Member) string
+	group bool
+}
+
+// matchRecipient 在MemberMap中查找
+func (w *Wechat) matchRecipient(selector, name string, rules []recipientRule) (string, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	// 靠前的规则匹配到时不再看后面的规则
+	for _, r := range rules {
+		var userNames []string
+		for userName, member := range w.MemberMap {
+			if userName == "" || userName == w.User.UserName {
+				continue
+			}
+			if r.group && !strings.HasPrefix(userName, "@@") {
+				continue
+			}
+			if r.field(member) == name {
+				userNames = append(userNames, userName)
+			}
+		}
+		switch len(userNames) {
+		case 0:
+			continue
+		case 1:
+			return userNames[0], nil
+		}
+		sort.Strings(userNames)
+		return "", &AmbiguousError{Selector: selector, UserNames: userNames}
+	}
+	return "", fmt.Errorf("找不到联系人: %s", selector)
+}
@@ -0,0 +1,80 @@
+package wechat
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestResolveRecipient(t *testing.T) {
+	w := NewWechat(GetLogger())
+	w.User.UserName = "@self"
+	for _, m := range []Member{
+		{UserName: "@self", NickName: "ops bot"},
+		{UserName: "@a", NickName: "Alice", RemarkName: "customer-42"},
+		{UserName: "@b", NickName: "Bob", Alias: "bob_wx"},
+		{UserName: "@c", NickName: "Bob"},
+		{UserName: "@d", NickName: "customer-42"},
+		{UserName: "@@room", NickName: "war room"},
+		{UserName: "@e", NickName: "war room"},
+	} {
+		w.setMember(m)
+	}
+
+	cases := map[string]string{
+		"@raw":                "@raw",
+		"customer-42":         "@a",
+		"nick:customer-42":    "@d",
+		"bob_wx":              "@b",
+		"alias:bob_wx":        "@b",
+		"Alice":               "@a",
+		"group:war room":      "@@room",
+		" remark:customer-42": "@a",
+	}
+	for selector, want := range cases {
+		got, err := w.ResolveRecipient(selector)
+		if err != nil || got != want {
+			t.Fatalf("%s: %s %v", selector, got, err)
+		}
+	}
+
+	_, err := w.ResolveRecipient("Bob")
+	if e, ok := err.(*AmbiguousError); !ok || len(e.UserNames) != 2 || e.UserNames[0] != "@b" {
+		t.Fatalf("%v", err)
+	}
+	if _, err := w.ResolveRecipient("war room"); err == nil {
+		t.Fatal("ambiguous topic resolved")
+	}
+	for _, selector := range []string{"", "nobody", "ops bot", "group:Alice", "remark:"} {
+		if got, err := w.ResolveRecipient(selector); err == nil {
+			t.Fatalf("%q resolved to %s", selector, got)
+		}
+	}
+}
+
+func TestResolveRecipientLoadsContacts(t *testing.T) {
+	loads := 0
+	w, server := newTestWechat(t, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != APIPath+WebWxContactListPath {
+			http.NotFound(rw, req)
+			return
+		}
+		loads++
+		rw.Write([]byte(`{"BaseResponse":{"Ret":0,"ErrMsg":""},"MemberCount":1,"Seq":0,"MemberList":[
+			{"UserName":"@new","NickName":"Alice","RemarkName":"customer-42"}]}`))
+	}))
+	defer server.Close()
+
+	got, err := w.ResolveRecipient("remark:customer-42")
+	if err != nil || got != "@new" {
+		t.Fatalf("%s %v", got, err)
+	}
+	if _, err := w.ResolveRecipient("nobody"); err == nil {
+		t.Fatal("nobody resolved")
+	}
+	if matches := w.SearchContacts("alice", 0); len(matches) != 1 {
+		t.Fatalf("%+v", matches)
+	}
+	if loads != 1 {
+		t.Fatalf("contacts loaded %d times", loads)
+	}
+}
@@ -0,0 +1,180 @@
+package wechat
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// 搜索匹配方式的得分
+const (
+	matchExact  = 400
+	matchPrefix = 300
+	matchSubstr = 200
+	matchFuzzy  = 100
+)
+
+// ContactMatch 联系人搜索结果
+type ContactMatch struct {
+	UserName   string `json:"userName"`
+	NickName   string `json:"nickName"`
+	RemarkName string `json:"remarkName"`
+	Alias      string `json:"alias"`
+	IsGroup    bool   `json:"isGroup"`
+	Field      string `json:"field"`
+	Score      int    `json:"score"`
+}
+
+// contactIndex 联系人搜索索引，MemberMap变化后重建，需要持有w.mu
+type contactIndex struct {
+	entries []indexEntry
+	fresh   bool
+}
+
+type indexEntry struct {
+	member Member
+	fields []indexField
+}
+
+type indexField struct {
+	name   string
+	value  string
+	weight int
+}
+
+// setMember 更新联系人，需要持有w.mu
+func (w *Wechat) setMember(member Member) {
+	w.MemberMap[member.UserName] = member
+	w.index.fresh = false
+}
+
+// deleteMember 删除联系人，需要持有w.mu
+func (w *Wechat) deleteMember(userName string) {
+	delete(w.MemberMap, userName)
+	w.index.fresh = false
+}
+
+// SearchContacts 按备注、昵称、微信号及其拼音搜索联系人和群，按匹配程度排序
+func (w *Wechat) SearchContacts(query string, limit int) []ContactMatch {
+	query = normalize(query)
+	if query == "" {
+		return nil
+	}
+	if err := w.loadContacts(); err != nil {
+		w.Log.Printf("%s SearchContacts load contacts faild: %s", w.GetUUID(), err.Error())
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.index.fresh {
+		w.buildIndex()
+	}
+	var matches []ContactMatch
+	for _, entry := range w.index.entries {
+		best := ContactMatch{}
+		for _, field := range entry.fields {
+			score := matchScore(field.value, query)
+			if score == 0 {
+				continue
+			}
+			score += field.weight
+			if score > best.Score {
+				best.Score = score
+				best.Field = field.name
+			}
+		}
+		if best.Score == 0 {
+			continue
+		}
+		best.UserName = entry.member.UserName
+		best.NickName = entry.member.NickName
+		best.RemarkName = entry.member.RemarkName
+		best.Alias = entry.member.Alias
+		best.IsGroup = strings.HasPrefix(entry.member.UserName, "@@")
+		matches = append(matches, best)
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return displayName(matches[i]) < displayName(matches[j])
+	})
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
+
+// buildIndex 重建搜索索引
+func (w *Wechat) buildIndex() {
+	w.index.entries = w.index.entries[:0]
+	for _, member := range w.MemberMap {
+		if member.UserName == "" || member.UserName == w.User.UserName {
+			continue
+		}
+		entry := indexEntry{member: member}
+		for _, field := range []indexField{
+			{"RemarkName", member.RemarkName, 30},
+			{"RemarkPYInitial", member.RemarkPYInitial, 25},
+			{"RemarkPYQuanPin", member.RemarkPYQuanPin, 25},
+			{"NickName", member.NickName, 20},
+			{"PYInitial", member.PYInitial, 15},
+			{"PYQuanPin", member.PYQuanPin, 15},
+			{"Alias", member.Alias, 10},
+		} {
+			if field.value = normalize(field.value); field.value != "" {
+				entry.fields = append(entry.fields, field)
+			}
+		}
+		if len(entry.fields) != 0 {
+			w.index.entries = append(w.index.entries, entry)
+		}
+	}
+	w.index.fresh = true
+}
+
+// matchScore 完全匹配 > 前缀 > 包含 > 按顺序出现的模糊匹配，越短的字段得分越高
+func matchScore(value, query string) int {
+	var score int
+	switch {
+	case value == query:
+		score = matchExact
+	case strings.HasPrefix(value, query):
+		score = matchPrefix
+	case strings.Contains(value, query):
+		score = matchSubstr
+	case isSubsequence(value, query):
+		score = matchFuzzy
+	default:
+		return 0
+	}
+	// 多出来的字符越少越接近
+	extra := utf8.RuneCountInString(value) - utf8.RuneCountInString(query)
+	if extra > 50 {
+		extra = 50
+	}
+	return score - extra
+}
+
+// isSubsequence query的字符按顺序出现在value中
+func isSubsequence(value, query string) bool {
+	q := []rune(query)
+	i := 0
+	for _, r := range value {
+		if i < len(q) && r == q[i] {
+			i++
+		}
+	}
+	return i == len(q)
+}
+
+// normalize 小写并去掉空白
+func normalize(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), "")
+}
+
+func displayName(m ContactMatch) string {
+	if m.RemarkName != "" {
+		return m.RemarkName
+	}
+	return m.NickName
+}
@@ -0,0 +1,44 @@
+package wechat
+
+import "testing"
+
+func TestSearchContacts(t *testing.T) {
+	w := NewWechat(GetLogger())
+	w.User.UserName = "@self"
+	for _, m := range []Member{
+		{UserName: "@self", NickName: "张三"},
+		{UserName: "@zs", NickName: "张三", PYInitial: "ZS", PYQuanPin: "zhangsan"},
+		{UserName: "@zsf", NickName: "张三丰", PYInitial: "ZSF", PYQuanPin: "zhangsanfeng", Alias: "taiji"},
+		{UserName: "@ls", NickName: "李四", PYInitial: "LS", PYQuanPin: "lisi", RemarkName: "客户-张", RemarkPYInitial: "KHZ", RemarkPYQuanPin: "kehuzhang"},
+		{UserName: "@@room", NickName: "张三 项目群", PYInitial: "ZSXMQ", PYQuanPin: "zhangsanxiangmuqun"},
+	} {
+		w.setMember(m)
+	}
+
+	matches := w.SearchContacts("张三", 0)
+	if len(matches) != 3 || matches[0].UserName != "@zs" || matches[1].UserName != "@zsf" || matches[2].UserName != "@@room" || !matches[2].IsGroup {
+		t.Fatalf("%+v", matches)
+	}
+	if matches := w.SearchContacts("zs", 1); len(matches) != 1 || matches[0].UserName != "@zs" || matches[0].Field != "PYInitial" {
+		t.Fatalf("%+v", matches)
+	}
+	if matches := w.SearchContacts("KHZ", 0); len(matches) != 1 || matches[0].UserName != "@ls" || matches[0].Field != "RemarkPYInitial" {
+		t.Fatalf("%+v", matches)
+	}
+	if matches := w.SearchContacts("zhsf", 0); len(matches) != 1 || matches[0].UserName != "@zsf" {
+		t.Fatalf("%+v", matches)
+	}
+	if matches := w.SearchContacts("taiji", 0); len(matches) != 1 || matches[0].Field != "Alias" {
+		t.Fatalf("%+v", matches)
+	}
+	if matches := w.SearchContacts("  ", 0); matches != nil {
+		t.Fatalf("%+v", matches)
+	}
+
+	w.deleteMember("@zs")
+	w.setMember(Member{UserName: "@ww", NickName: "王五", RemarkName: "张三的同事"})
+	matches = w.SearchContacts("张三", 0)
+	if len(matches) != 3 || matches[0].UserName != "@ww" {
+		t.Fatalf("%+v", matches)
+	}
+}
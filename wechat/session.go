@@ -0,0 +1,252 @@
+package wechat
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrSessionNotFound session not found
+var ErrSessionNotFound = errors.New("session not found")
+
+// Session 可持久化的登录信息，重启后无需重新扫码
+type Session struct {
+	UUID        string                    `json:"uuid"`
+	DeviceID    string                    `json:"deviceId"`
+	BaseRequest BaseRequest               `json:"baseRequest"`
+	PassTicket  string                    `json:"passTicket"`
+	SyncKey     SyncKey                   `json:"syncKey"`
+	Host        Host                      `json:"host"`
+	User        User                      `json:"user"`
+	Cookies     map[string][]*http.Cookie `json:"cookies"`
+	Friend      FriendPolicy              `json:"friendPolicy"`
+	UpdatedAt   time.Time                 `json:"updatedAt"`
+}
+
+// SessionStore 保存登录信息
+type SessionStore interface {
+	Save(key string, session *Session) error
+	Load(key string) (*Session, error)
+	Delete(key string) error
+	Keys() ([]string, error)
+}
+
+// Session 导出当前登录信息
+func (w *Wechat) Session() *Session {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	session := &Session{
+		UUID:        w.uuID,
+		DeviceID:    w.deviceID,
+		BaseRequest: *w.Request.BaseRequest,
+		PassTicket:  w.Request.BaseRequest.PassTicket,
+		SyncKey:     w.Response.SyncKey,
+		Host:        w.host,
+		User:        w.User,
+		Cookies:     map[string][]*http.Cookie{},
+		Friend:      w.FriendPolicy(),
+		UpdatedAt:   time.Now(),
+	}
+	if w.Client.Jar != nil {
+		for _, host := range []string{w.host.Login, w.host.File, w.host.Push} {
+			cookies := w.Client.Jar.Cookies(&url.URL{Scheme: "https", Host: host, Path: "/"})
+			if len(cookies) != 0 {
+				session.Cookies[host] = cookies
+			}
+		}
+	}
+	return session
+}
+
+// Restore 恢复登录信息，恢复后分发OnLogin
+func (w *Wechat) Restore(session *Session) {
+	w.restore(session)
+	w.emitLogin()
+}
+
+// restore 恢复登录信息
+func (w *Wechat) restore(session *Session) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.uuID = session.UUID
+	if session.DeviceID != "" {
+		w.deviceID = session.DeviceID
+	}
+	baseRequest := session.BaseRequest
+	baseRequest.PassTicket = session.PassTicket
+	baseRequest.DeviceID = w.deviceID
+	w.Request.BaseRequest = &baseRequest
+	w.Response.BaseResponse = &BaseResponse{}
+	w.Response.SyncKey = session.SyncKey
+	w.SyncKeyStr = syncKeyString(session.SyncKey)
+	w.User = session.User
+	w.host = session.Host
+	w.mediaCache.reset()
+	w.contactsLoaded = false
+	w.friends.Lock()
+	w.friends.policy = session.Friend
+	w.friends.Unlock()
+	if w.Client.Jar != nil {
+		for host, cookies := range session.Cookies {
+			w.Client.Jar.SetCookies(&url.URL{Scheme: "https", Host: host, Path: "/"}, cookies)
+		}
+	}
+	w.Log.Printf("%s Restore session: %s", w.GetUUID(), w.User.NickName)
+}
+
+// SetSessionStore 登录、同步成功后保存到store
+func (w *Wechat) SetSessionStore(store SessionStore, key string) {
+	w.store = store
+	w.storeKey = key
+}
+
+// SaveSession 保存登录信息
+func (w *Wechat) SaveSession() error {
+	if w.store == nil || !w.IsLogin() {
+		return nil
+	}
+	if err := w.store.Save(w.storeKey, w.Session()); err != nil {
+		w.Log.Printf("%s SaveSession faild: %s", w.GetUUID(), err.Error())
+		return err
+	}
+	return nil
+}
+
+// MemorySessionStore 内存存储，进程退出后丢失
+type MemorySessionStore struct {
+	sessions map[string]*Session
+	sync.RWMutex
+}
+
+// NewMemorySessionStore new memory session store
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions: map[string]*Session{},
+	}
+}
+
+// Save save session
+func (s *MemorySessionStore) Save(key string, session *Session) error {
+	s.Lock()
+	defer s.Unlock()
+	s.sessions[key] = session
+	return nil
+}
+
+// Load load session
+func (s *MemorySessionStore) Load(key string) (*Session, error) {
+	s.RLock()
+	defer s.RUnlock()
+	session, ok := s.sessions[key]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	return session, nil
+}
+
+// Delete delete session
+func (s *MemorySessionStore) Delete(key string) error {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.sessions, key)
+	return nil
+}
+
+// Keys all session keys
+func (s *MemorySessionStore) Keys() ([]string, error) {
+	s.RLock()
+	defer s.RUnlock()
+	keys := make([]string, 0, len(s.sessions))
+	for key := range s.sessions {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// FileSessionStore 文件存储，每个账号一个json文件
+type FileSessionStore struct {
+	dir string
+	sync.Mutex
+}
+
+// NewFileSessionStore new file session store
+func NewFileSessionStore(dir string) (*FileSessionStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileSessionStore{dir: dir}, nil
+}
+
+func (s *FileSessionStore) path(key string) string {
+	return filepath.Join(s.dir, url.PathEscape(key)+".json")
+}
+
+// Save save session
+func (s *FileSessionStore) Save(key string, session *Session) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	tmp := s.path(key) + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(key))
+}
+
+// Load load session
+func (s *FileSessionStore) Load(key string) (*Session, error) {
+	data, err := ioutil.ReadFile(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	session := new(Session)
+	if err = json.Unmarshal(data, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// Delete delete session
+func (s *FileSessionStore) Delete(key string) error {
+	s.Lock()
+	defer s.Unlock()
+	err := os.Remove(s.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Keys all session keys
+func (s *FileSessionStore) Keys() ([]string, error) {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		key, err := url.PathUnescape(strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
@@ -0,0 +1,70 @@
+package wechat
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"testing"
+)
+
+func TestSessionRestore(t *testing.T) {
+	w := NewWechat(GetLogger())
+	w.uuID = "IcyiwdKOXg=="
+	w.host = hostFor("wx2.qq.com")
+	w.Request.BaseRequest.Skey = "@crypt_skey"
+	w.Request.BaseRequest.Wxsid = "sid"
+	w.Request.BaseRequest.Wxuin = 123456
+	w.Request.BaseRequest.PassTicket = "ticket"
+	w.Response.SyncKey = SyncKey{Count: 1, List: []KeyVal{{Key: 1, Val: 2}}}
+	w.User.UserName = "@self"
+	w.Client.Jar.SetCookies(&url.URL{Scheme: "https", Host: "wx2.qq.com", Path: "/"}, []*http.Cookie{
+		{Name: "webwx_data_ticket", Value: "data_ticket"},
+	})
+
+	dir, err := ioutil.TempDir("", "wxapi-session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, store := range []SessionStore{NewMemorySessionStore(), mustFileSessionStore(t, dir)} {
+		if err := store.Save("user/1", w.Session()); err != nil {
+			t.Fatal(err)
+		}
+		keys, err := store.Keys()
+		if err != nil || len(keys) != 1 || keys[0] != "user/1" {
+			t.Fatalf("%v %v", keys, err)
+		}
+		session, err := store.Load("user/1")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		restored := NewWechat(GetLogger())
+		restored.Restore(session)
+		if !restored.IsLogin() || restored.Request.BaseRequest.Wxuin != 123456 || restored.GetUUID() != w.GetUUID() {
+			t.Fatalf("%+v", restored.Request.BaseRequest)
+		}
+		if restored.SyncKeyStr != "1_2" || restored.User.UserName != "@self" || restored.Host() != w.Host() {
+			t.Fatalf("%s %+v %+v", restored.SyncKeyStr, restored.User, restored.Host())
+		}
+		if v := restored.cookie("webwx_data_ticket"); v != "data_ticket" {
+			t.Fatalf("%s", v)
+		}
+
+		if err := store.Delete("user/1"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Load("user/1"); err != ErrSessionNotFound {
+			t.Fatalf("%v", err)
+		}
+	}
+}
+
+func mustFileSessionStore(t *testing.T, dir string) *FileSessionStore {
+	store, err := NewFileSessionStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
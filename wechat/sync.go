@@ -0,0 +1,213 @@
+package wechat
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sync 拉取新消息、联系人变更，并更新SyncKey
+func (w *Wechat) Sync(ctx context.Context) (syncResp *SyncResp, err error) {
+	if !w.IsLogin() {
+		return nil, fmt.Errorf("请重新登录")
+	}
+	w.Log.Printf("%s Sync start", w.GetUUID())
+	wxurl := fmt.Sprintf("%s?sid=%s&skey=%s&pass_ticket=%s&lang=%s",
+		w.apiURL(WebWxSyncPath),
+		w.Request.BaseRequest.Wxsid,
+		w.Request.BaseRequest.Skey,
+		w.Request.BaseRequest.PassTicket,
+		Lang,
+	)
+	w.mu.RLock()
+	params := SyncParams{
+		BaseRequest: *w.Request.BaseRequest,
+		SyncKey:     w.Response.SyncKey,
+		RR:          ^time.Now().Unix(),
+	}
+	w.mu.RUnlock()
+
+	syncResp = new(SyncResp)
+	if err = w.postJSON(ctx, wxurl, params, syncResp); err != nil {
+		w.Log.Printf("%s Sync faild: %s", w.GetUUID(), err.Error())
+		return nil, err
+	}
+	if syncResp.BaseResponse == nil {
+		return nil, fmt.Errorf("Sync: empty BaseResponse")
+	}
+	if syncResp.BaseResponse.Ret != StatusSuccess {
+		w.Log.Printf("%s Sync faild: ret=%d", w.GetUUID(), syncResp.BaseResponse.Ret)
+		return nil, fmt.Errorf("Sync: ret=%d %s", syncResp.BaseResponse.Ret, syncResp.BaseResponse.ErrMsg)
+	}
+
+	w.mu.Lock()
+	if syncResp.SyncKey.Count > 0 {
+		w.Response.SyncKey = syncResp.SyncKey
+	}
+	// synccheck 优先使用 SyncCheckKey
+	if syncResp.SyncCheckKey.Count > 0 {
+		w.SyncKeyStr = syncKeyString(syncResp.SyncCheckKey)
+	} else {
+		w.SyncKeyStr = syncKeyString(w.Response.SyncKey)
+	}
+	for _, member := range syncResp.ModContactList {
+		w.setMember(member)
+	}
+	for _, member := range syncResp.DelContactList {
+		w.deleteMember(member.UserName)
+	}
+	w.mu.Unlock()
+
+	w.Log.Printf("%s Sync success: msg=%d mod=%d del=%d",
+		w.GetUUID(),
+		syncResp.AddMsgCount,
+		syncResp.ModContactCount,
+		syncResp.DelContactCount,
+	)
+	return syncResp, nil
+}
+
+// LogoutError 服务端结束了会话
+type LogoutError struct {
+	RetCode int
+}
+
+func (e *LogoutError) Error() string {
+	switch e.RetCode {
+	case SyncCheckRetLogout:
+		return "已在手机上退出网页版微信"
+	case SyncCheckRetLoginOther:
+		return "已在其他地方登录网页版微信"
+	case SyncCheckRetExpired:
+		return "会话已失效，请重新登录"
+	}
+	return fmt.Sprintf("会话已结束: retcode=%d", e.RetCode)
+}
+
+// Run 长轮询synccheck，有新消息时调用webwxsync；退出登录或ctx取消时返回，返回前分发OnLogout
+func (w *Wechat) Run(ctx context.Context) (err error) {
+	if !w.IsLogin() {
+		return fmt.Errorf("请重新登录")
+	}
+	w.Log.Printf("%s Run start", w.GetUUID())
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	w.mu.Lock()
+	w.cancel = cancel
+	w.runDone = done
+	w.mu.Unlock()
+	defer func() {
+		cancel()
+		w.mu.Lock()
+		if w.runDone == done {
+			w.cancel = nil
+			w.runDone = nil
+		}
+		// 调用Logout结束的
+		if w.stopErr != nil {
+			err = w.stopErr
+			w.stopErr = nil
+		}
+		w.mu.Unlock()
+		close(done)
+		w.emitLogout(err)
+	}()
+	retry := 0
+	// 网络、服务端错误一直重试，只有退出登录或ctx取消时结束
+	fail := func(err error) error {
+		retry++
+		w.Log.Printf("%s Run retry %d: %s", w.GetUUID(), retry, err.Error())
+		select {
+		case <-time.After(syncBackoff(retry)):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	for {
+		if ctx.Err() != nil {
+			w.Log.Printf("%s Run stop: %s", w.GetUUID(), ctx.Err().Error())
+			return ctx.Err()
+		}
+		checkResp, err := w.SyncCheck(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			if err = fail(err); err != nil {
+				return err
+			}
+			continue
+		}
+		switch checkResp.RetCode {
+		case SyncCheckRetSuccess:
+		case SyncCheckRetLogout, SyncCheckRetLoginOther, SyncCheckRetExpired:
+			err = &LogoutError{RetCode: checkResp.RetCode}
+			w.Log.Printf("%s Run stop: %s", w.GetUUID(), err.Error())
+			return err
+		default:
+			if err = fail(fmt.Errorf("synccheck retcode=%d", checkResp.RetCode)); err != nil {
+				return err
+			}
+			continue
+		}
+		if checkResp.Selector == 0 {
+			retry = 0
+			continue
+		}
+		syncResp, err := w.Sync(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			if err = fail(err); err != nil {
+				return err
+			}
+			continue
+		}
+		retry = 0
+		w.handleSync(ctx, syncResp)
+		w.SaveSession()
+	}
+}
+
+// handleSync 处理同步到的消息
+func (w *Wechat) handleSync(ctx context.Context, syncResp *SyncResp) {
+	for i := range syncResp.AddMsgList {
+		msg := &syncResp.AddMsgList[i]
+		w.Log.Printf("%s receive msg: id=%s type=%d from=%s to=%s",
+			w.GetUUID(), msg.MsgID, msg.MsgType, msg.FromUserName, msg.ToUserName)
+		w.messages.add(msg)
+		w.countUnread(msg)
+		if msg.MsgType == MsgTypeVerify {
+			w.handleFriendRequest(ctx, msg)
+		}
+		w.emitMessage(msg)
+	}
+	if len(syncResp.ModContactList) != 0 || len(syncResp.DelContactList) != 0 {
+		w.emitContactChange(syncResp.ModContactList, syncResp.DelContactList)
+	}
+}
+
+// syncBackoff 第retry次重试前等待的时间，指数增长，最长SyncRetryMaxDelay
+func syncBackoff(retry int) time.Duration {
+	delay := SyncRetryDelay
+	for i := 1; i < retry && delay < SyncRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > SyncRetryMaxDelay {
+		delay = SyncRetryMaxDelay
+	}
+	return delay
+}
+
+// syncKeyString format SyncKey as key_val|key_val
+func syncKeyString(syncKey SyncKey) string {
+	items := make([]string, 0, len(syncKey.List))
+	for _, item := range syncKey.List {
+		items = append(items, strconv.Itoa(item.Key)+"_"+strconv.Itoa(item.Val))
+	}
+	return strings.Join(items, "|")
+}
@@ -0,0 +1,163 @@
+package wechat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestSyncKeyString(t *testing.T) {
+	syncKey := SyncKey{
+		Count: 3,
+		List: []KeyVal{
+			{Key: 1, Val: 651234},
+			{Key: 2, Val: 651300},
+			{Key: 1000, Val: 1574520000},
+		},
+	}
+	if v := syncKeyString(syncKey); v != "1_651234|2_651300|1000_1574520000" {
+		t.Fatalf("%s", v)
+	}
+	if v := syncKeyString(SyncKey{}); v != "" {
+		t.Fatalf("%s", v)
+	}
+}
+
+func TestSyncBackoff(t *testing.T) {
+	cases := map[int]time.Duration{
+		1:   SyncRetryDelay,
+		2:   2 * SyncRetryDelay,
+		3:   4 * SyncRetryDelay,
+		10:  SyncRetryMaxDelay,
+		100: SyncRetryMaxDelay,
+	}
+	for retry, want := range cases {
+		if got := syncBackoff(retry); got != want {
+			t.Fatalf("retry %d: %s != %s", retry, got, want)
+		}
+	}
+}
+
+func TestRunLogout(t *testing.T) {
+	for _, retCode := range []int{SyncCheckRetLogout, SyncCheckRetLoginOther, SyncCheckRetExpired} {
+		w, server := newTestWechat(t, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.URL.Path != APIPath+WebSyncCheckPath {
+				http.NotFound(rw, req)
+				return
+			}
+			fmt.Fprintf(rw, `window.synccheck={retcode:"%d",selector:"0"}`, retCode)
+		}))
+		var logoutErr error
+		w.OnLogout(func(w *Wechat, err error) {
+			logoutErr = err
+		})
+		err := w.Run(context.Background())
+		server.Close()
+		logoutError, ok := err.(*LogoutError)
+		if !ok || logoutError.RetCode != retCode || logoutErr != err {
+			t.Fatalf("%d: %v %v", retCode, err, logoutErr)
+		}
+	}
+}
+
+func TestRunRetry(t *testing.T) {
+	var checks, syncs int
+	w, server := newTestWechat(t, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case APIPath + WebSyncCheckPath:
+			checks++
+			switch checks {
+			case 1:
+				// webpush临时出错
+				http.Error(rw, "bad gateway", http.StatusBadGateway)
+			case 2:
+				rw.Write([]byte(`window.synccheck={retcode:"0",selector:"2"}`))
+			default:
+				rw.Write([]byte(`window.synccheck={retcode:"1101",selector:"0"}`))
+			}
+		case APIPath + WebWxSyncPath:
+			syncs++
+			rw.Write([]byte(`{"BaseResponse":{"Ret":0,"ErrMsg":""},"AddMsgCount":1,
+			"AddMsgList":[{"MsgId":"3001","MsgType":1,"FromUserName":"@friend","ToUserName":"@self","Content":"hello"}],
+			"SyncKey":{"Count":1,"List":[{"Key":1,"Val":100}]}}`))
+		default:
+			http.NotFound(rw, req)
+		}
+	}))
+	defer server.Close()
+	var received []string
+	w.OnMessage(func(w *Wechat, msg *Message) {
+		received = append(received, msg.MsgID)
+	})
+
+	start := time.Now()
+	err := w.Run(context.Background())
+	if logoutErr, ok := err.(*LogoutError); !ok || logoutErr.RetCode != SyncCheckRetLoginOther {
+		t.Fatalf("%v", err)
+	}
+	if checks != 3 || syncs != 1 || len(received) != 1 || received[0] != "3001" {
+		t.Fatalf("checks=%d syncs=%d received=%v", checks, syncs, received)
+	}
+	if time.Since(start) < SyncRetryDelay {
+		t.Fatal("retry without backoff")
+	}
+}
+
+func TestSync(t *testing.T) {
+	var params SyncParams
+	var query url.Values
+	w, server := newTestWechat(t, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != APIPath+WebWxSyncPath {
+			http.NotFound(rw, req)
+			return
+		}
+		query = req.URL.Query()
+		json.NewDecoder(req.Body).Decode(&params)
+		rw.Write([]byte(`{"BaseResponse":{"Ret":0,"ErrMsg":""},
+		"AddMsgCount":2,"AddMsgList":[
+			{"MsgId":"4001","MsgType":1,"FromUserName":"@friend","ToUserName":"@self","Content":"hello","CreateTime":1574520000},
+			{"MsgId":"4002","MsgType":49,"AppMsgType":5,"FromUserName":"@@group","ToUserName":"@self","Url":"https://example.com","FileName":"link"}],
+		"ModContactCount":1,"ModContactList":[{"UserName":"@friend","NickName":"Alice","RemarkName":"客户A"}],
+		"DelContactCount":1,"DelContactList":[{"UserName":"@gone"}],
+		"SyncKey":{"Count":2,"List":[{"Key":1,"Val":200},{"Key":2,"Val":201}]},
+		"SyncCheckKey":{"Count":3,"List":[{"Key":1,"Val":200},{"Key":2,"Val":201},{"Key":1000,"Val":300}]}}`))
+	}))
+	defer server.Close()
+	w.Request.BaseRequest.Wxsid = "sid"
+	w.Response.SyncKey = SyncKey{Count: 1, List: []KeyVal{{Key: 1, Val: 100}}}
+	w.MemberMap["@gone"] = Member{UserName: "@gone"}
+
+	syncResp, err := w.Sync(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query.Get("sid") != "sid" || query.Get("skey") != "skey" || query.Get("pass_ticket") != "ticket" {
+		t.Fatalf("%v", query)
+	}
+	if params.SyncKey.Count != 1 || len(params.SyncKey.List) != 1 || params.SyncKey.List[0].Val != 100 {
+		t.Fatalf("%+v", params.SyncKey)
+	}
+
+	msgs := syncResp.AddMsgList
+	if len(msgs) != 2 || msgs[0].MsgID != "4001" || msgs[0].MsgType != MsgTypeText || msgs[0].Text() != "hello" ||
+		msgs[0].CreateTime != 1574520000 || msgs[1].AppMsgType != AppMsgTypeURL || msgs[1].URL != "https://example.com" {
+		t.Fatalf("%+v", msgs)
+	}
+	if w.Response.SyncKey.Count != 2 || w.Response.SyncKey.List[1].Val != 201 {
+		t.Fatalf("%+v", w.Response.SyncKey)
+	}
+	// synccheck使用SyncCheckKey
+	if w.SyncKeyStr != "1_200|2_201|1000_300" {
+		t.Fatalf("%s", w.SyncKeyStr)
+	}
+	if member, ok := w.MemberMap["@friend"]; !ok || member.RemarkName != "客户A" {
+		t.Fatalf("%+v", w.MemberMap)
+	}
+	if _, ok := w.MemberMap["@gone"]; ok {
+		t.Fatal("deleted contact still in MemberMap")
+	}
+}
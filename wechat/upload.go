@@ -0,0 +1,332 @@
+package wechat
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// UploadMedia 上传本地文件
+func (w *Wechat) UploadMedia(mediaPath string) (mediaID string, err error) {
+	f, err := os.Open(mediaPath)
+	if err != nil {
+		w.Log.Printf("%s  UploadMedia: open file faild %+v", w.GetUUID(), err)
+		return
+	}
+	defer f.Close()
+	fStat, err := f.Stat()
+	if err != nil {
+		w.Log.Printf("%s  UploadMedia: file stat faild %+v", w.GetUUID(), err)
+		return
+	}
+	return w.UploadMediaReader(context.Background(), filepath.Base(mediaPath), fStat.Size(), f)
+}
+
+// UploadMediaReader 从r读取size字节上传，按文件内容判断类型
+func (w *Wechat) UploadMediaReader(ctx context.Context, name string, size int64, r io.Reader) (mediaID string, err error) {
+	if !w.IsLogin() {
+		err = fmt.Errorf("请重新登录")
+		return
+	}
+	w.Log.Printf("%s UploadMedia: name:%s size:%d", w.GetUUID(), name, size)
+	contentType, r, err := sniff(r)
+	if err != nil {
+		return
+	}
+	mediaID, _, _, err = w.uploadCached(ctx, "", name, size, mediaTypeOf(contentType), r)
+	return
+}
+
+// sendUploaded 上传后发送，缓存的MediaId被服务端拒绝时删除缓存重新上传一次
+func (w *Wechat) sendUploaded(ctx context.Context, toUserName, name string, size int64, mediaType string, r io.Reader, send func(mediaID string) (*SentMessage, error)) (*SentMessage, error) {
+	mediaID, key, cached, err := w.uploadCached(ctx, toUserName, name, size, mediaType, r)
+	if err != nil {
+		w.Log.Printf("%s UploadMedia faild: name=%s", w.GetUUID(), name)
+		return nil, err
+	}
+	sent, err := send(mediaID)
+	if err == nil || !cached || !mediaInvalid(err) {
+		return sent, err
+	}
+	// 命中缓存时没有读取r，可以重新上传
+	w.Log.Printf("%s cached MediaId rejected, upload again: %s", w.GetUUID(), err.Error())
+	w.mediaCache.delete(key)
+	if mediaID, _, _, err = w.uploadCached(ctx, toUserName, name, size, mediaType, r); err != nil {
+		w.Log.Printf("%s UploadMedia faild: name=%s", w.GetUUID(), name)
+		return nil, err
+	}
+	return send(mediaID)
+}
+
+// uploadCached 相同内容在MediaCacheTTL内直接使用缓存的MediaId
+func (w *Wechat) uploadCached(ctx context.Context, toUserName, name string, size int64, mediaType string, r io.Reader) (mediaID, key string, cached bool, err error) {
+	sum, err := hashSeeker(r, size)
+	if err != nil {
+		return
+	}
+	var h hash.Hash
+	if sum == "" {
+		// 不能Seek时边上传边计算
+		h = sha256.New()
+		r = io.TeeReader(r, h)
+	} else {
+		key = mediaCacheKey(mediaType, toUserName, sum)
+		if mediaID, cached = w.mediaCache.get(key); cached {
+			w.Log.Printf("%s UploadMedia cached: name=%s mediaId=%s", w.GetUUID(), name, mediaID)
+			return
+		}
+	}
+	mediaID, err = w.upload(ctx, toUserName, name, size, mediaType, r)
+	if err != nil {
+		return
+	}
+	if h != nil {
+		key = mediaCacheKey(mediaType, toUserName, hex.EncodeToString(h.Sum(nil)))
+	}
+	w.mediaCache.set(key, mediaID)
+	return
+}
+
+// mediaCacheKey 上传时带了ToUserName，MediaId只给同一个会话使用
+func mediaCacheKey(mediaType, toUserName, sum string) string {
+	return mediaType + ":" + toUserName + ":" + sum
+}
+
+// mediaInvalid 服务端明确拒绝了MediaId(过期或无效)，网络错误、频率限制等不重新上传
+func mediaInvalid(err error) bool {
+	retErr, ok := err.(*RetError)
+	return ok && retErr.Ret == RetMediaInvalid
+}
+
+// hashSeeker 计算r中size字节的sha256后Seek回原位置，r不能Seek时返回空
+func hashSeeker(r io.Reader, size int64) (string, error) {
+	rs, ok := r.(io.ReadSeeker)
+	if !ok {
+		return "", nil
+	}
+	offset, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "", nil
+	}
+	h := sha256.New()
+	if _, err = io.CopyN(h, rs, size); err != nil {
+		return "", err
+	}
+	if _, err = rs.Seek(offset, io.SeekStart); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// sniff 读取文件头判断内容类型，返回的reader包含已读取的文件头，r能Seek时原样返回
+func sniff(r io.Reader) (contentType string, reader io.Reader, err error) {
+	rs, seekable := r.(io.ReadSeeker)
+	var offset int64
+	if seekable {
+		if offset, err = rs.Seek(0, io.SeekCurrent); err != nil {
+			seekable = false
+		}
+	}
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", nil, err
+	}
+	head = head[:n]
+	contentType = http.DetectContentType(head)
+	if seekable {
+		if _, err = rs.Seek(offset, io.SeekStart); err != nil {
+			return "", nil, err
+		}
+		return contentType, r, nil
+	}
+	return contentType, io.MultiReader(bytes.NewReader(head), r), nil
+}
+
+// mediaTypeOf 按内容类型选择mediatype，gif按表情走doc
+func mediaTypeOf(contentType string) string {
+	switch contentType {
+	case "image/jpeg", "image/png", "image/bmp", "image/webp":
+		return MediaTypePic
+	case "video/mp4":
+		return MediaTypeVideo
+	}
+	return MediaTypeDoc
+}
+
+// upload 按UploadChunkSize分片上传，最后一片返回MediaId
+func (w *Wechat) upload(ctx context.Context, toUserName, filename string, size int64, mediaType string, r io.Reader) (mediaID string, err error) {
+	if size <= 0 {
+		return "", fmt.Errorf("文件为空")
+	}
+	contentType, r, err := sniff(r)
+	if err != nil {
+		return
+	}
+	uploadReq := Request{
+		BaseRequest:   w.Request.BaseRequest,
+		UploadType:    2,
+		ClientMediaID: strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10),
+		TotalLen:      size,
+		StartPos:      0,
+		DataLen:       size,
+		MediaType:     4,
+		FromUserName:  w.User.UserName,
+		ToUserName:    toUserName,
+	}
+	jur, err := json.Marshal(uploadReq)
+	if err != nil {
+		return
+	}
+	fields := [][2]string{
+		{"id", "WU_FILE_0"},
+		{"name", filename},
+		{"type", contentType},
+		{"lastModifiedDate", time.Now().Format("Mon Jan 02 2006 15:04:05 GMT-0700 (MST)")},
+		{"size", strconv.FormatInt(size, 10)},
+		{"mediatype", mediaType},
+		{"uploadmediarequest", string(jur)},
+		{"webwx_data_ticket", w.cookie("webwx_data_ticket")},
+		{"pass_ticket", w.Request.BaseRequest.PassTicket},
+	}
+
+	chunks := (size + UploadChunkSize - 1) / UploadChunkSize
+	chunk := make([]byte, UploadChunkSize)
+	var sent int64
+	for i := int64(0); i < chunks; i++ {
+		n, err := io.ReadFull(r, chunk[:min64(UploadChunkSize, size-sent)])
+		if err != nil {
+			w.Log.Printf("UploadMedia: %s read chunk %d faild %+v", w.GetUUID(), i, err)
+			return "", err
+		}
+		chunkFields := fields
+		if chunks > 1 {
+			chunkFields = append(chunkFields[:len(fields):len(fields)],
+				[2]string{"chunks", strconv.FormatInt(chunks, 10)},
+				[2]string{"chunk", strconv.FormatInt(i, 10)},
+			)
+		}
+		mediaResp, err := w.uploadChunk(ctx, filename, chunkFields, chunk[:n])
+		if err != nil {
+			w.Log.Printf("UploadMedia: %s upload chunk %d/%d faild %+v", w.GetUUID(), i, chunks, err)
+			return "", err
+		}
+		sent += int64(n)
+		mediaID = mediaResp.MediaID
+		w.emitUploadProgress(filename, sent, size)
+	}
+	if mediaID == "" {
+		return "", fmt.Errorf("上传失败: 没有MediaId")
+	}
+	w.Log.Printf("%s UploadMedia success: %s", w.GetUUID(), mediaID)
+	return mediaID, nil
+}
+
+// uploadChunk 上传一个分片
+func (w *Wechat) uploadChunk(ctx context.Context, filename string, fields [][2]string, data []byte) (*MediaResponse, error) {
+	bodyBuf := new(bytes.Buffer)
+	bodyWriter := multipart.NewWriter(bodyBuf)
+	for _, field := range fields {
+		if err := bodyWriter.WriteField(field[0], field[1]); err != nil {
+			return nil, err
+		}
+	}
+	fw, err := bodyWriter.CreateFormFile("filename", filename)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = fw.Write(data); err != nil {
+		return nil, err
+	}
+	if err = bodyWriter.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.fileURL(WebUploadMediaPath)+"?f=json", bodyBuf)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", bodyWriter.FormDataContentType())
+	req.Header.Set("User-Agent", UserAgent)
+	resp, err := w.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("UploadMedia: status code = %d", resp.StatusCode)
+	}
+	mediaResp := new(MediaResponse)
+	if err = json.NewDecoder(resp.Body).Decode(mediaResp); err != nil {
+		return nil, err
+	}
+	if mediaResp.BaseResponse == nil || mediaResp.BaseResponse.Ret != StatusSuccess {
+		return nil, fmt.Errorf("上传失败: %+v", mediaResp.BaseResponse)
+	}
+	return mediaResp, nil
+}
+
+// mediaCache 内容hash对应的MediaId
+type mediaCache struct {
+	items map[string]mediaCacheItem
+	sync.Mutex
+}
+
+type mediaCacheItem struct {
+	mediaID string
+	expire  time.Time
+}
+
+func (c *mediaCache) get(key string) (string, bool) {
+	c.Lock()
+	defer c.Unlock()
+	item, ok := c.items[key]
+	if !ok {
+		return "", false
+	}
+	if time.Now().After(item.expire) {
+		delete(c.items, key)
+		return "", false
+	}
+	return item.mediaID, true
+}
+
+func (c *mediaCache) set(key, mediaID string) {
+	c.Lock()
+	defer c.Unlock()
+	if c.items == nil {
+		c.items = map[string]mediaCacheItem{}
+	}
+	now := time.Now()
+	for k, item := range c.items {
+		if now.After(item.expire) {
+			delete(c.items, k)
+		}
+	}
+	c.items[key] = mediaCacheItem{mediaID: mediaID, expire: now.Add(MediaCacheTTL)}
+}
+
+func (c *mediaCache) delete(key string) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.items, key)
+}
+
+// reset 会话变化后MediaId失效
+func (c *mediaCache) reset() {
+	c.Lock()
+	defer c.Unlock()
+	c.items = nil
+}
@@ -0,0 +1,174 @@
+package wechat
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestUploadChunks(t *testing.T) {
+	var mu sync.Mutex
+	received := new(bytes.Buffer)
+	chunks := []string{}
+	w, server := newTestWechat(t, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if err := req.ParseMultipartForm(UploadChunkSize * 2); err != nil {
+			t.Error(err)
+			return
+		}
+		f, _, err := req.FormFile("filename")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		data, _ := ioutil.ReadAll(f)
+		mu.Lock()
+		received.Write(data)
+		chunks = append(chunks, req.FormValue("chunk")+"/"+req.FormValue("chunks"))
+		mu.Unlock()
+		fmt.Fprintf(rw, `{"BaseResponse":{"Ret":0,"ErrMsg":""},"MediaId":"@crypt_%s"}`, req.FormValue("chunk"))
+	}))
+	defer server.Close()
+
+	var progress []int64
+	w.OnUploadProgress(func(w *Wechat, name string, sent, total int64) {
+		progress = append(progress, sent)
+	})
+
+	data := bytes.Repeat([]byte("0123456789"), UploadChunkSize/4)
+	mediaID, err := w.upload(context.Background(), "@friend", "big.zip", int64(len(data)), MediaTypeDoc, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mediaID != "@crypt_2" {
+		t.Fatalf("%s", mediaID)
+	}
+	if fmt.Sprint(chunks) != "[0/3 1/3 2/3]" {
+		t.Fatalf("%v", chunks)
+	}
+	if !bytes.Equal(received.Bytes(), data) {
+		t.Fatalf("received %d bytes", received.Len())
+	}
+	if fmt.Sprint(progress) != fmt.Sprint([]int64{UploadChunkSize, UploadChunkSize * 2, int64(len(data))}) {
+		t.Fatalf("%v", progress)
+	}
+}
+
+func TestSendAuto(t *testing.T) {
+	var mediaType, contentType, sentPath string
+	w, server := newTestWechat(t, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == APIPath+WebUploadMediaPath {
+			mediaType = req.FormValue("mediatype")
+			contentType = req.FormValue("type")
+			rw.Write([]byte(`{"BaseResponse":{"Ret":0,"ErrMsg":""},"MediaId":"@crypt_media"}`))
+			return
+		}
+		sentPath = req.URL.Path[len(APIPath):]
+		rw.Write([]byte(`{"BaseResponse":{"Ret":0,"ErrMsg":""},"MsgID":"1","LocalID":"2"}`))
+	}))
+	defer server.Close()
+
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	mp4 := []byte("\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom")
+	cases := []struct {
+		name, mediaType, contentType, path string
+		data                               []byte
+	}{
+		{"report.final.png", MediaTypePic, "image/png", WebSendMediaPath, png},
+		{"clip", MediaTypeVideo, "video/mp4", WebWxSendVideoMsgPath, mp4},
+		{"sticker.jpg", MediaTypeDoc, "image/gif", WebWxSendEmoticonPath, []byte("GIF89a")},
+		{"notes.png", MediaTypeDoc, "text/plain; charset=utf-8", WebWxSendAppMsgPath, []byte("hello")},
+	}
+	for _, c := range cases {
+		_, err := w.SendAutoReader(context.Background(), "@friend", c.name, int64(len(c.data)), bytes.NewReader(c.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mediaType != c.mediaType || contentType != c.contentType || sentPath != c.path {
+			t.Errorf("%s: %s %s %s", c.name, mediaType, contentType, sentPath)
+		}
+	}
+	if _, err := w.SendImageReader(context.Background(), "@friend", "a.png", 5, bytes.NewReader([]byte("hello"))); err == nil {
+		t.Fatal("expect error for non image")
+	}
+}
+
+func TestMediaCache(t *testing.T) {
+	uploads := 0
+	rejectRet := 0
+	w, server := newTestWechat(t, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == APIPath+WebUploadMediaPath {
+			uploads++
+			fmt.Fprintf(rw, `{"BaseResponse":{"Ret":0,"ErrMsg":""},"MediaId":"@crypt_%d"}`, uploads)
+			return
+		}
+		if rejectRet != 0 {
+			fmt.Fprintf(rw, `{"BaseResponse":{"Ret":%d,"ErrMsg":"rejected"}}`, rejectRet)
+			rejectRet = 0
+			return
+		}
+		rw.Write([]byte(`{"BaseResponse":{"Ret":0,"ErrMsg":""},"MsgID":"1","LocalID":"2"}`))
+	}))
+	defer server.Close()
+
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR chart")
+	send := func(r io.Reader) {
+		if _, err := w.SendImageReader(context.Background(), "@friend", "chart.png", int64(len(png)), r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	send(bytes.NewReader(png))
+	send(bytes.NewReader(png))
+	if uploads != 1 {
+		t.Fatalf("uploads=%d", uploads)
+	}
+
+	// 服务端拒绝缓存的MediaId后重新上传
+	rejectRet = RetMediaInvalid
+	send(bytes.NewReader(png))
+	if uploads != 2 {
+		t.Fatalf("uploads=%d", uploads)
+	}
+
+	// 频率限制等其他错误不重新上传
+	rejectRet = RetFreqLimit
+	if _, err := w.SendImageReader(context.Background(), "@friend", "chart.png", int64(len(png)), bytes.NewReader(png)); err == nil {
+		t.Fatal("rate limit ignored")
+	}
+	if uploads != 2 {
+		t.Fatalf("uploads=%d", uploads)
+	}
+
+	// 不同会话分别上传
+	if _, err := w.SendImageReader(context.Background(), "@other", "chart.png", int64(len(png)), bytes.NewReader(png)); err != nil {
+		t.Fatal(err)
+	}
+	if uploads != 3 {
+		t.Fatalf("uploads=%d", uploads)
+	}
+
+	// 不能Seek的reader上传后也会缓存
+	other := append([]byte{}, png...)
+	other = append(other, '!')
+	if _, err := w.SendImageReader(context.Background(), "@friend", "b.png", int64(len(other)), ioutil.NopCloser(bytes.NewReader(other))); err != nil {
+		t.Fatal(err)
+	}
+	send(bytes.NewReader(png))
+	if _, err := w.SendImageReader(context.Background(), "@friend", "b.png", int64(len(other)), bytes.NewReader(other)); err != nil {
+		t.Fatal(err)
+	}
+	if uploads != 4 {
+		t.Fatalf("uploads=%d", uploads)
+	}
+
+	// 会话变化后缓存失效
+	w.Restore(w.Session())
+	send(bytes.NewReader(png))
+	if uploads != 5 {
+		t.Fatalf("uploads=%d", uploads)
+	}
+}
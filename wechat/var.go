@@ -1,9 +1,13 @@
 package wechat
 
 import (
+	"context"
+	"encoding/json"
 	"encoding/xml"
 	"log"
 	"net/http"
+	"sync"
+	"time"
 )
 
 // const code
@@ -11,6 +15,28 @@ const (
 	StatusSuccess       = 0
 	WxResultSuccessCode = "200"
 	LoginTimeout        = 50
+	SyncRetryDelay      = time.Second
+	SyncRetryMaxDelay   = time.Minute
+	MessageCacheSize    = 1000
+	UploadChunkSize     = 512 * 1024
+	MediaCacheTTL       = 6 * time.Hour
+	BatchContactSize    = 50
+	FriendRequestMax    = 200
+	FriendRequestTTL    = 72 * time.Hour
+)
+
+// synccheck retcode
+const (
+	SyncCheckRetSuccess    = 0
+	SyncCheckRetLogout     = 1100 // 手机端退出网页版
+	SyncCheckRetLoginOther = 1101 // 在其他地方登录网页版
+	SyncCheckRetExpired    = 1102 // 会话失效
+)
+
+// 发送消息的ret
+const (
+	RetMediaInvalid = 1    // MediaId过期或无效
+	RetFreqLimit    = 1205 // 操作太频繁
 )
 
 // brower
@@ -49,15 +75,63 @@ const (
 	LoginURL = "https://login.weixin.qq.com/jslogin"
 	QrURL    = "https://login.weixin.qq.com/qrcode/"
 
-	FetchLoginURL       = "https://login.weixin.qq.com/cgi-bin/mmwebwx-bin/login"
-	WxBaseURL           = "https://wx.qq.com/cgi-bin/mmwebwx-bin"
-	WebWxInitURL        = WxBaseURL + "/webwxinit"
-	WebWxContactListURL = WxBaseURL + "/webwxgetcontact"
-	WebWxSendMsg        = WxBaseURL + "/webwxsendmsg"
-	WebSyncCheckURL     = WxBaseURL + "/synccheck"
-	WebUploadMediaURL   = WxBaseURL + "/webwxuploadmedia"
-	WebSendMediaURL     = WxBaseURL + "/webwxsendmsgimg"
-	TuringURL           = "http://www.tuling123.com/openapi/api"
+	FetchLoginURL = "https://login.weixin.qq.com/cgi-bin/mmwebwx-bin/login"
+	TuringURL     = "http://www.tuling123.com/openapi/api"
+)
+
+// api path, 域名由登录跳转地址决定
+const (
+	APIPath                 = "/cgi-bin/mmwebwx-bin"
+	WebWxInitPath           = "/webwxinit"
+	WebWxContactListPath    = "/webwxgetcontact"
+	WebWxSendMsgPath        = "/webwxsendmsg"
+	WebSyncCheckPath        = "/synccheck"
+	WebWxSyncPath           = "/webwxsync"
+	WebUploadMediaPath      = "/webwxuploadmedia"
+	WebSendMediaPath        = "/webwxsendmsgimg"
+	WebWxGetMsgImgPath      = "/webwxgetmsgimg"
+	WebWxGetVoicePath       = "/webwxgetvoice"
+	WebWxGetVideoPath       = "/webwxgetvideo"
+	WebWxGetMediaPath       = "/webwxgetmedia"
+	WebWxSendAppMsgPath     = "/webwxsendappmsg"
+	WebWxSendVideoMsgPath   = "/webwxsendvideomsg"
+	WebWxSendEmoticonPath   = "/webwxsendemoticon"
+	WebWxRevokeMsgPath      = "/webwxrevokemsg"
+	WebWxCreateChatroomPath = "/webwxcreatechatroom"
+	WebWxUpdateChatroomPath = "/webwxupdatechatroom"
+	WebWxBatchContactPath   = "/webwxbatchgetcontact"
+	WebWxOplogPath          = "/webwxoplog"
+	WebWxVerifyUserPath     = "/webwxverifyuser"
+	WebWxStatusNotifyPath   = "/webwxstatusnotify"
+	WebWxLogoutPath         = "/webwxlogout"
+	WebWxGetIconPath        = "/webwxgeticon"
+	WebWxGetHeadImgPath     = "/webwxgetheadimg"
+)
+
+// webwxoplog cmdid
+const (
+	OplogCmdRemarkName = 2
+)
+
+// 旧的固定wx.qq.com地址，只对该域名下的账号有效
+//
+// Deprecated: 域名由登录跳转地址决定，使用APIPath和对应的*Path
+const (
+	WxBaseURL           = "https://wx.qq.com" + APIPath
+	WebWxInitURL        = WxBaseURL + WebWxInitPath
+	WebWxContactListURL = WxBaseURL + WebWxContactListPath
+	WebWxSendMsg        = WxBaseURL + WebWxSendMsgPath
+	WebSyncCheckURL     = WxBaseURL + WebSyncCheckPath
+	WebWxSyncURL        = WxBaseURL + WebWxSyncPath
+	WebUploadMediaURL   = WxBaseURL + WebUploadMediaPath
+	WebSendMediaURL     = WxBaseURL + WebSendMediaPath
+)
+
+// upload mediatype
+const (
+	MediaTypePic   = "pic"
+	MediaTypeVideo = "video"
+	MediaTypeDoc   = "doc"
 )
 
 // appID
@@ -65,6 +139,7 @@ const (
 	// appID
 	AppID        = "wx782c26e4c19acffb"
 	AppKEY       = "391ad66ebad2477b908dce8e79f101e7"
+	FileAppID    = "wxeb7ec651dd0aefa9"
 	TUringUserID = "abc123"
 	// DeviceID
 	deviceID = "e123456789002237"
@@ -78,7 +153,7 @@ type Wechat struct {
 	deviceID        string
 	uuID            string
 	qrImagePath     string
-	baseURL         string
+	host            Host
 	redirectedURL   string
 	Client          *http.Client
 	Request         *Request
@@ -95,6 +170,20 @@ type Wechat struct {
 	GroupList       []string
 	MemberCount     int
 	Log             *log.Logger
+	store           SessionStore
+	storeKey        string
+	handlers        handlers
+	messages        messageCache
+	mediaCache      mediaCache
+	friends         friendRequests
+	unread          map[string]int
+	cancel          context.CancelFunc
+	runDone         chan struct{}
+	stopErr         error
+	loginCancel     context.CancelFunc
+	index           contactIndex
+	contactsLoaded  bool
+	mu              sync.RWMutex
 }
 
 // BaseRequest login xml response
@@ -112,18 +201,23 @@ type BaseRequest struct {
 
 // Request Request
 type Request struct {
-	BaseRequest   *BaseRequest
-	MemberCount   int    `json:",omitempty"`
-	MemberList    []User `json:",omitempty"`
-	Topic         string `json:",omitempty"`
-	ChatRoomName  string `json:",omitempty"`
-	DelMemberList string `json:",omitempty"`
-	AddMemberList string `json:",omitempty"`
-	ClientMediaID string `json:",omitempty"`
-	TotalLen      int64  `json:",omitempty"`
-	StartPos      int    `json:",omitempty"`
-	DataLen       int64  `json:",omitempty"`
-	MediaType     int    `json:",omitempty"`
+	BaseRequest      *BaseRequest
+	MemberCount      int    `json:",omitempty"`
+	MemberList       []User `json:",omitempty"`
+	Topic            string `json:",omitempty"`
+	ChatRoomName     string `json:",omitempty"`
+	DelMemberList    string `json:",omitempty"`
+	AddMemberList    string `json:",omitempty"`
+	InviteMemberList string `json:",omitempty"`
+	NewTopic         string `json:",omitempty"`
+	ClientMediaID    string `json:"ClientMediaId,omitempty"`
+	UploadType       int    `json:",omitempty"`
+	TotalLen         int64  `json:",omitempty"`
+	StartPos         int    `json:",omitempty"`
+	DataLen          int64  `json:",omitempty"`
+	MediaType        int    `json:",omitempty"`
+	FromUserName     string `json:",omitempty"`
+	ToUserName       string `json:",omitempty"`
 }
 
 // User user struct
@@ -196,32 +290,84 @@ type Member struct {
 	UserName         string
 	NickName         string
 	HeadImgURL       string
-	ContactFlag      int    `json:"-"`
-	MemberCount      int    `json:"-"`
-	MemberList       []User `json:"-"`
-	RemarkName       string `json:"-"`
-	HideInputBarFlag int    `json:"-"`
-	Sex              int    `json:"-"`
-	Signature        string `json:"-"`
-	VerifyFlag       int    `json:"-"`
-	OwnerUin         int    `json:"-"`
-	PYInitial        string `json:"-"`
-	PYQuanPin        string `json:"-"`
-	RemarkPYInitial  string `json:"-"`
-	RemarkPYQuanPin  string `json:"-"`
-	StarFriend       int    `json:"-"`
-	AppAccountFlag   int    `json:"-"`
-	Statues          int    `json:"-"`
-	AttrStatus       int    `json:"-"`
-	Province         string `json:"-"`
-	City             string `json:"-"`
-	Alias            string `json:"-"`
-	SnsFlag          int    `json:"-"`
-	UniFriend        int    `json:"-"`
-	DisplayName      string `json:"-"`
-	ChatRoomID       int    `json:"-"`
-	KeyWord          string `json:"-"`
-	EncryChatRoomID  string `json:"-"`
+	ContactFlag      int           `json:"-"`
+	MemberCount      int           `json:"-"`
+	MemberList       []GroupMember `json:"-"`
+	RemarkName       string        `json:"-"`
+	HideInputBarFlag int           `json:"-"`
+	Sex              int           `json:"-"`
+	Signature        string        `json:"-"`
+	VerifyFlag       int           `json:"-"`
+	OwnerUin         int           `json:"-"`
+	PYInitial        string        `json:"-"`
+	PYQuanPin        string        `json:"-"`
+	RemarkPYInitial  string        `json:"-"`
+	RemarkPYQuanPin  string        `json:"-"`
+	StarFriend       int           `json:"-"`
+	AppAccountFlag   int           `json:"-"`
+	Statues          int           `json:"-"`
+	AttrStatus       int           `json:"-"`
+	Province         string        `json:"-"`
+	City             string        `json:"-"`
+	Alias            string        `json:"-"`
+	SnsFlag          int           `json:"-"`
+	UniFriend        int           `json:"-"`
+	DisplayName      string        `json:"-"`
+	ChatRoomID       int           `json:"-"`
+	KeyWord          string        `json:"-"`
+	EncryChatRoomID  string        `json:"-"`
+}
+
+// UnmarshalJSON 忽略输出用的json:"-"，解析接口返回的全部字段
+func (m *Member) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Uin              int64
+		UserName         string
+		NickName         string
+		HeadImgURL       string
+		ContactFlag      int
+		MemberCount      int
+		MemberList       []GroupMember
+		RemarkName       string
+		HideInputBarFlag int
+		Sex              int
+		Signature        string
+		VerifyFlag       int
+		OwnerUin         int
+		PYInitial        string
+		PYQuanPin        string
+		RemarkPYInitial  string
+		RemarkPYQuanPin  string
+		StarFriend       int
+		AppAccountFlag   int
+		Statues          int
+		AttrStatus       int
+		Province         string
+		City             string
+		Alias            string
+		SnsFlag          int
+		UniFriend        int
+		DisplayName      string
+		ChatRoomID       int `json:"ChatRoomId"`
+		KeyWord          string
+		EncryChatRoomID  string `json:"EncryChatRoomId"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*m = Member(v)
+	return nil
+}
+
+// GroupMember 群成员
+type GroupMember struct {
+	Uin          int64
+	UserName     string
+	NickName     string
+	AttrStatus   int
+	DisplayName  string
+	MemberStatus int
+	KeyWord      string
 }
 
 // MemberResp MemberResp
@@ -233,6 +379,22 @@ type MemberResp struct {
 	Seq          int
 }
 
+// ChatroomResp 建群返回
+type ChatroomResp struct {
+	InnerResponse
+	Topic        string
+	MemberCount  int
+	MemberList   []Member
+	ChatRoomName string
+}
+
+// BatchContactResp webwxbatchgetcontact返回
+type BatchContactResp struct {
+	InnerResponse
+	Count       int
+	ContactList []Member
+}
+
 // ContractResponse ContractResponse
 type ContractResponse struct {
 	GroupMemberList []Member `json:"groupMembers"`
@@ -256,9 +418,15 @@ type SyncParams struct {
 // SyncResp sync response
 type SyncResp struct {
 	Response
-	SyncKey      SyncKey       `json:"SyncKey"`
-	ContinueFlag int           `json:"ContinueFlag"`
-	AddMsgList   []interface{} `json:"AddMsgList"`
+	SyncKey         SyncKey   `json:"SyncKey"`
+	SyncCheckKey    SyncKey   `json:"SyncCheckKey"`
+	ContinueFlag    int       `json:"ContinueFlag"`
+	AddMsgCount     int       `json:"AddMsgCount"`
+	AddMsgList      []Message `json:"AddMsgList"`
+	ModContactCount int       `json:"ModContactCount"`
+	ModContactList  []Member  `json:"ModContactList"`
+	DelContactCount int       `json:"DelContactCount"`
+	DelContactList  []Member  `json:"DelContactList"`
 }
 
 // MediaResponse MediaResponse
@@ -270,3 +438,17 @@ type MediaResponse struct {
 	CDNThumbImgWidth  int    `json:"CDNThumbImgWidth"`
 	EncryFileName     string `json:"EncryFileName"`
 }
+
+// SendMsgResponse 发送消息返回
+type SendMsgResponse struct {
+	InnerResponse
+	MsgID   string `json:"MsgID"`
+	LocalID string `json:"LocalID"`
+}
+
+// SentMessage 已发送的消息，用于撤回
+type SentMessage struct {
+	MsgID      string `json:"msgId"`
+	LocalID    string `json:"localId"`
+	ToUserName string `json:"toUserName"`
+}
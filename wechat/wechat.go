@@ -10,8 +10,6 @@ import (
 	"io"
 	"io/ioutil"
 	"log"
-	"math/rand"
-	"mime/multipart"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
@@ -28,6 +26,7 @@ func NewWechat(logger *log.Logger) *Wechat {
 	return &Wechat{
 		Client:   getHTTPClient(),
 		deviceID: getDeviceID(),
+		host:     hostFor(SyncHostQQ),
 		Request: &Request{
 			BaseRequest: new(BaseRequest),
 		},
@@ -60,11 +59,26 @@ func (w *Wechat) GetQr() (path string, err error) {
 // Login login
 func (w *Wechat) Login(ctx context.Context) (err error) {
 	w.Log.Printf("%s Login start", w.GetUUID())
+	// Logout可以取消等待扫码
+	ctx, cancel := context.WithCancel(ctx)
+	w.mu.Lock()
+	w.loginCancel = cancel
+	w.mu.Unlock()
+	defer func() {
+		cancel()
+		w.mu.Lock()
+		w.loginCancel = nil
+		w.mu.Unlock()
+	}()
 	err = w.login(ctx)
 	if err != nil {
 		w.Log.Printf("%s Login faild： error:%s", w.GetUUID(), err.Error())
 		return
 	}
+	w.mediaCache.reset()
+	w.mu.Lock()
+	w.contactsLoaded = false
+	w.mu.Unlock()
 
 	w.Log.Printf("%s webwxinit start", w.GetUUID())
 	err = w.webwxinit()
@@ -72,7 +86,18 @@ func (w *Wechat) Login(ctx context.Context) (err error) {
 		w.Log.Printf("%s webwxinit faild： error:%s", w.GetUUID(), err.Error())
 		return
 	}
+	if ctx.Err() != nil {
+		// 登录过程中调用了Logout，不保存登录信息
+		w.Log.Printf("%s Login canceled", w.GetUUID())
+		w.clearCredentials()
+		return ctx.Err()
+	}
+	if err := w.statusNotify(ctx, StatusNotifyCodeInited, w.User.UserName); err != nil {
+		w.Log.Printf("%s init status notify faild： error:%s", w.GetUUID(), err.Error())
+	}
 	w.Log.Printf("%s Login success", w.GetUUID())
+	w.SaveSession()
+	w.emitLogin()
 	return
 }
 
@@ -86,6 +111,7 @@ func (w *Wechat) login(ctx context.Context) (err error) {
 	if w.redirectedURL == "" {
 		return
 	}
+	w.setHost()
 	response, err := w.Client.Get(w.redirectedURL + "&fun=new")
 	if err != nil {
 		w.Log.Printf("%s login faild： error:%s", w.GetUUID(), err.Error())
@@ -115,11 +141,11 @@ func (w *Wechat) webwxinit() (err error) {
 	if w.Request.BaseRequest.PassTicket == "" {
 		return
 	}
-	wxinitURL := fmt.Sprintf("%s?pass_ticket=%s", WebWxInitURL, w.Request.BaseRequest.PassTicket)
+	wxinitURL := fmt.Sprintf("%s?pass_ticket=%s", w.apiURL(WebWxInitPath), w.Request.BaseRequest.PassTicket)
 	data, err := json.Marshal(w.Request)
 	response, err := w.Client.Post(wxinitURL, ContentTypeJSON, bytes.NewReader(data))
 	if err != nil {
-		w.Log.Printf("get webwxinit :%v", WebWxInitURL)
+		w.Log.Printf("get webwxinit :%v", wxinitURL)
 		return
 	}
 
@@ -135,16 +161,7 @@ func (w *Wechat) webwxinit() (err error) {
 	}
 	w.ChatSet = strings.Split(w.Response.ChatSet, ",")
 	w.User = w.Response.User
-	w.SyncKeyStr = ""
-	for i, item := range w.Response.SyncKey.List {
-		if i == 0 {
-			w.SyncKeyStr = strconv.Itoa(item.Key) + "_" + strconv.Itoa(item.Val)
-			continue
-		}
-
-		w.SyncKeyStr += "|" + strconv.Itoa(item.Key) + "_" + strconv.Itoa(item.Val)
-
-	}
+	w.SyncKeyStr = syncKeyString(w.Response.SyncKey)
 	cookies := response.Cookies()
 	w.Log.Printf("cookie num: %+v", len(cookies))
 	for cookie := range cookies {
@@ -164,42 +181,42 @@ func (w *Wechat) GetContactList() (contractResponse *ContractResponse, err error
 		return nil, fmt.Errorf("请重新登录")
 	}
 	w.Log.Printf("%s GetContactList start", w.GetUUID())
-	wxurl := fmt.Sprintf("%s?pass_ticket=%s&skey=%s&r=%d",
-		WebWxContactListURL,
-		w.Request.BaseRequest.PassTicket,
-		w.Request.BaseRequest.Skey,
-		time.Now().Unix(),
-	)
-
-	data, err := json.Marshal(w.Request)
-	response, err := w.Client.Post(wxurl, ContentTypeJSON, bytes.NewReader(data))
-	if err != nil {
-		w.Log.Printf("get webwxgetcontact :%v", WebWxInitURL)
-		w.Log.Printf("%s GetContactList faild: %s", w.GetUUID(), err.Error())
-		return nil, err
-	}
-
-	defer response.Body.Close()
-	reader := response.Body.(io.Reader)
-	wxResponse := new(MemberResp)
-	if err = json.NewDecoder(reader).Decode(&wxResponse); err != nil {
-		w.Log.Printf("%s GetContactList parse json faild: %s", w.GetUUID(), err.Error())
-		w.Log.Printf("webwxgetcontact: %+v", err)
-		return nil, err
-	}
-	if wxResponse.BaseResponse.Ret != 0 {
-		return nil, fmt.Errorf("登录过期，请重新登录")
+	var members []Member
+	seq := 0
+	for {
+		wxResponse, err := w.fetchContactPage(seq)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, wxResponse.MemberList...)
+		w.Log.Printf("%s GetContactList page: seq=%d count=%d next=%d", w.GetUUID(), seq, wxResponse.MemberCount, wxResponse.Seq)
+		// seq为0时没有下一页
+		if wxResponse.Seq == 0 || wxResponse.Seq == seq {
+			break
+		}
+		seq = wxResponse.Seq
 	}
-	respjson, err := json.Marshal(wxResponse)
-	w.Log.Printf("%s GetContactList resp: %s", w.GetUUID(), string(respjson))
 	if w.Response.BaseResponse.Ret != StatusSuccess {
 		return nil, fmt.Errorf(w.Response.BaseResponse.ErrMsg)
 	}
-	w.MemberList = wxResponse.MemberList
-	w.MemberCount = wxResponse.Count
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.contactsLoaded = true
+	w.MemberList = members
+	w.MemberCount = len(members)
+	w.ContactList = nil
+	w.GroupMemberList = nil
+	w.PublicUserList = nil
 	for _, member := range w.MemberList {
-		w.MemberMap[member.UserName] = member
-		if member.UserName[:2] == "@@" {
+		if member.UserName == "" {
+			continue
+		}
+		// 保留BatchGetContact获取到的群成员
+		if old, ok := w.MemberMap[member.UserName]; ok && len(member.MemberList) == 0 {
+			member.MemberList = old.MemberList
+		}
+		w.setMember(member)
+		if strings.HasPrefix(member.UserName, "@@") {
 			w.GroupMemberList = append(w.GroupMemberList, member) //群聊
 
 		} else if member.VerifyFlag&8 != 0 {
@@ -211,7 +228,7 @@ func (w *Wechat) GetContactList() (contractResponse *ContractResponse, err error
 	mb := Member{}
 	mb.NickName = w.User.NickName
 	mb.UserName = w.User.UserName
-	w.MemberMap[w.User.UserName] = mb
+	w.setMember(mb)
 	jsonStr, err := json.MarshalIndent(w.Response, "", "")
 	for _, user := range w.ChatSet {
 		exist := false
@@ -244,214 +261,267 @@ func (w *Wechat) GetContactList() (contractResponse *ContractResponse, err error
 	return
 }
 
-// SendMsg send message
-func (w *Wechat) SendMsg(toUserName, message string, isFile bool) (err error) {
-	if !w.IsLogin() {
-		return fmt.Errorf("请重新登录")
-	}
-	w.Log.Printf("%s sendMsg: toUserName:%s;message:%s", w.GetUUID(), toUserName, message)
-	wxurl := fmt.Sprintf("%s?pass_ticket=%s&skey=%s&r=%d",
-		WebWxSendMsg,
+// fetchContactPage webwxgetcontact 按seq分页
+func (w *Wechat) fetchContactPage(seq int) (*MemberResp, error) {
+	wxurl := fmt.Sprintf("%s?pass_ticket=%s&skey=%s&seq=%d&r=%d",
+		w.apiURL(WebWxContactListPath),
 		w.Request.BaseRequest.PassTicket,
 		w.Request.BaseRequest.Skey,
+		seq,
 		time.Now().Unix(),
 	)
-	clientMsgID := fmt.Sprintf("%d0%s", time.Now().Unix(), strconv.Itoa(rand.Int())[3:6])
-
-	params := make(map[string]interface{})
-	params["BaseRequest"] = w.Request.BaseRequest
-	msg := make(map[string]interface{})
-	msg["Type"] = 1
-	msg["Content"] = message
-	msg["FromUserName"] = w.User.UserName
-	msg["LocalID"] = clientMsgID
-	msg["ClientMsgId"] = clientMsgID
-	msg["ToUserName"] = toUserName
-	params["Msg"] = msg
-	data, err := json.Marshal(params)
-	response, err := w.Client.Post(wxurl, ContentTypeJSON, bytes.NewReader(data))
-	if err != nil {
-		w.Log.Printf("%s get SendMsg faild:%s", w.GetUUID(), err.Error())
-		return err
-	}
-
-	defer response.Body.Close()
-	reader := response.Body.(io.Reader)
 	wxResponse := new(MemberResp)
-	if err = json.NewDecoder(reader).Decode(&wxResponse); err != nil {
-		w.Log.Printf("%s json decode SendMsg: %+v", w.GetUUID(), err)
-		return err
+	if err := w.postJSON(context.Background(), wxurl, w.Request, wxResponse); err != nil {
+		w.Log.Printf("%s GetContactList faild: %s", w.GetUUID(), err.Error())
+		return nil, err
 	}
-	if w.Response.BaseResponse.Ret != StatusSuccess {
-		return fmt.Errorf(w.Response.BaseResponse.ErrMsg)
+	if wxResponse.BaseResponse == nil || wxResponse.BaseResponse.Ret != 0 {
+		return nil, fmt.Errorf("登录过期，请重新登录")
 	}
-	w.Log.Printf("%s SendMsg success", w.GetUUID())
-	return
+	return wxResponse, nil
 }
 
-// SendMedia 发送图片
-func (w *Wechat) SendMedia(toUserName, mediaPath string) error {
+// SendMsg send message
+func (w *Wechat) SendMsg(toUserName, message string, isFile bool) (sent *SentMessage, err error) {
+	return w.SendText(context.Background(), toUserName, message)
+}
+
+// SendText 发送文本消息
+func (w *Wechat) SendText(ctx context.Context, toUserName, message string) (*SentMessage, error) {
 	if !w.IsLogin() {
-		return fmt.Errorf("请重新登录")
+		return nil, fmt.Errorf("请重新登录")
 	}
-	w.Log.Printf("%s SendMedia: toUserName:%s;mediaPath:%s", w.GetUUID(), toUserName, mediaPath)
-
-	mediaID, err := w.UploadMedia(mediaPath)
-	if err != nil {
-		w.Log.Printf("%s UploadMedia faild: mediaPath=%s", w.GetUUID(), mediaPath)
-		return err
+	w.Log.Printf("%s sendMsg: toUserName:%s;message:%s", w.GetUUID(), toUserName, message)
+	msg := map[string]interface{}{
+		"Type":    MsgTypeText,
+		"Content": message,
 	}
-	wxurl := fmt.Sprintf("%s?pass_ticket=%s&fun=async&skey=%s&r=%d",
-		WebSendMediaURL,
-		w.Request.BaseRequest.PassTicket,
-		w.Request.BaseRequest.Skey,
-		time.Now().Unix(),
-	)
-	clientMsgID := fmt.Sprintf("%d0%s", time.Now().Unix(), strconv.Itoa(rand.Int())[3:6])
-	params := make(map[string]interface{})
-	params["BaseRequest"] = w.Request.BaseRequest
-	msg := make(map[string]interface{})
-	msg["Type"] = 1
-	msg["Content"] = ""
-	msg["MediaId"] = mediaID
-	msg["FromUserName"] = w.User.UserName
-	msg["LocalID"] = clientMsgID
-	msg["ClientMsgId"] = clientMsgID
-	msg["ToUserName"] = toUserName
-	params["Msg"] = msg
-	data, err := json.Marshal(params)
-	response, err := w.Client.Post(wxurl, ContentTypeJSON, bytes.NewReader(data))
+	query := fmt.Sprintf("skey=%s&r=%d", w.Request.BaseRequest.Skey, time.Now().Unix())
+	sent, err := w.postMsg(ctx, WebWxSendMsgPath, query, toUserName, msg)
 	if err != nil {
-		w.Log.Printf("%s get SendMsg faild:%s", w.GetUUID(), err.Error())
-		return err
+		w.Log.Printf("%s SendMsg faild:%s", w.GetUUID(), err.Error())
+		return nil, err
 	}
+	w.Log.Printf("%s SendMsg success", w.GetUUID())
+	return sent, nil
+}
 
-	defer response.Body.Close()
-	reader := response.Body.(io.Reader)
-	wxResponse := new(MemberResp)
-	if err = json.NewDecoder(reader).Decode(&wxResponse); err != nil {
-		w.Log.Printf("%s json decode SendMsg: %+v", w.GetUUID(), err)
-		return err
+// SendMedia 发送图片
+func (w *Wechat) SendMedia(toUserName, mediaPath string) (*SentMessage, error) {
+	return w.sendPath(toUserName, mediaPath, w.SendImageReader)
+}
+
+// SendFile 发送文件
+func (w *Wechat) SendFile(toUserName, filePath string) (*SentMessage, error) {
+	return w.sendPath(toUserName, filePath, w.SendFileReader)
+}
+
+// SendVideo 发送视频
+func (w *Wechat) SendVideo(toUserName, videoPath string) (*SentMessage, error) {
+	return w.sendPath(toUserName, videoPath, w.SendVideoReader)
+}
+
+// SendEmoticon 发送表情(gif)
+func (w *Wechat) SendEmoticon(toUserName, emoticonPath string) (*SentMessage, error) {
+	return w.sendPath(toUserName, emoticonPath, w.SendEmoticonReader)
+}
+
+// SendAuto 按文件内容发送图片、表情、视频或文件
+func (w *Wechat) SendAuto(toUserName, filePath string) (*SentMessage, error) {
+	return w.sendPath(toUserName, filePath, w.SendAutoReader)
+}
+
+// SendAutoReader 按文件内容发送图片、表情、视频或文件
+func (w *Wechat) SendAutoReader(ctx context.Context, toUserName, name string, size int64, r io.Reader) (*SentMessage, error) {
+	contentType, r, err := sniff(r)
+	if err != nil {
+		return nil, err
 	}
-	if w.Response.BaseResponse.Ret != StatusSuccess {
-		return fmt.Errorf(w.Response.BaseResponse.ErrMsg)
+	w.Log.Printf("%s SendAuto: toUserName:%s;name:%s;contentType:%s", w.GetUUID(), toUserName, name, contentType)
+	if contentType == "image/gif" {
+		return w.SendEmoticonReader(ctx, toUserName, name, size, r)
 	}
-	w.Log.Printf("%s SendMsg success", w.GetUUID())
-	return nil
+	switch mediaTypeOf(contentType) {
+	case MediaTypePic:
+		return w.SendImageReader(ctx, toUserName, name, size, r)
+	case MediaTypeVideo:
+		return w.SendVideoReader(ctx, toUserName, name, size, r)
+	}
+	return w.SendFileReader(ctx, toUserName, name, size, r)
 }
 
-// UploadMedia 上传图片
-func (w *Wechat) UploadMedia(mediaPath string) (mediaID string, err error) {
-
+// SendImageReader 发送图片
+func (w *Wechat) SendImageReader(ctx context.Context, toUserName, name string, size int64, r io.Reader) (*SentMessage, error) {
 	if !w.IsLogin() {
-		err = fmt.Errorf("请重新登录")
-		return
+		return nil, fmt.Errorf("请重新登录")
 	}
-	w.Log.Printf("%s UploadMedia: mediaPath:%s", w.GetUUID(), mediaPath)
-	f, err := os.Open(mediaPath)
+	w.Log.Printf("%s SendImage: toUserName:%s;name:%s", w.GetUUID(), toUserName, name)
+	contentType, r, err := sniff(r)
 	if err != nil {
-		w.Log.Printf("%s  UploadMedia: open file faild %+v", w.GetUUID(), err)
-		return
+		return nil, err
 	}
-	fStat, err := f.Stat()
+	// gif按图片发送只能收到静态图
+	if contentType == "image/gif" {
+		return w.SendEmoticonReader(ctx, toUserName, name, size, r)
+	}
+	if mediaTypeOf(contentType) != MediaTypePic {
+		return nil, fmt.Errorf("不是图片: %s", contentType)
+	}
+	sent, err := w.sendUploaded(ctx, toUserName, name, size, MediaTypePic, r, func(mediaID string) (*SentMessage, error) {
+		msg := map[string]interface{}{
+			"Type":    MsgTypeImage,
+			"MediaId": mediaID,
+			"Content": "",
+		}
+		return w.postMsg(ctx, WebSendMediaPath, "fun=async&f=json", toUserName, msg)
+	})
 	if err != nil {
-		w.Log.Printf("%s  UploadMedia: file stat faild %+v", w.GetUUID(), err)
-		return
+		w.Log.Printf("%s SendImage faild:%s", w.GetUUID(), err.Error())
+		return nil, err
 	}
-	bodyBuf := new(bytes.Buffer)
-	bodyWriter := multipart.NewWriter(bodyBuf)
-	_, filename := filepath.Split(mediaPath)
-	fw, err := bodyWriter.CreateFormFile("filename", filename)
+	w.Log.Printf("%s SendImage success", w.GetUUID())
+	return sent, nil
+}
 
+// SendFileReader 发送文件
+func (w *Wechat) SendFileReader(ctx context.Context, toUserName, name string, size int64, r io.Reader) (*SentMessage, error) {
+	if !w.IsLogin() {
+		return nil, fmt.Errorf("请重新登录")
+	}
+	w.Log.Printf("%s SendFile: toUserName:%s;name:%s", w.GetUUID(), toUserName, name)
+	ext := strings.TrimPrefix(filepath.Ext(name), ".")
+	sent, err := w.sendUploaded(ctx, toUserName, name, size, MediaTypeDoc, r, func(mediaID string) (*SentMessage, error) {
+		content := fmt.Sprintf("<appmsg appid='%s' sdkver=''><title>%s</title><des></des><action></action>"+
+			"<type>%d</type><content></content><url></url><lowurl></lowurl>"+
+			"<appattach><totallen>%d</totallen><attachid>%s</attachid><fileext>%s</fileext></appattach>"+
+			"<extinfo></extinfo></appmsg>",
+			FileAppID, xmlEscape(name), AppMsgTypeAttach, size, mediaID, xmlEscape(ext))
+		msg := map[string]interface{}{
+			"Type":    AppMsgTypeAttach,
+			"AppID":   FileAppID,
+			"Content": content,
+		}
+		return w.postMsg(ctx, WebWxSendAppMsgPath, "fun=async&f=json", toUserName, msg)
+	})
 	if err != nil {
-		w.Log.Printf("UploadMedia: %s bodyWriter.CreateFormFile faild %+v", w.GetUUID(), err)
-		return
+		w.Log.Printf("%s SendFile faild:%s", w.GetUUID(), err.Error())
+		return nil, err
 	}
-	if _, err = io.Copy(fw, f); err != nil {
-		fmt.Println(err, err == nil)
-		w.Log.Printf("%s  UploadMedia: file copy faild %+v", w.GetUUID(), err)
-		return
+	w.Log.Printf("%s SendFile success", w.GetUUID())
+	return sent, nil
+}
+
+// SendVideoReader 发送视频
+func (w *Wechat) SendVideoReader(ctx context.Context, toUserName, name string, size int64, r io.Reader) (*SentMessage, error) {
+	if !w.IsLogin() {
+		return nil, fmt.Errorf("请重新登录")
 	}
-	fInfo := strings.Split(filename, ".")
-	if len(fInfo) != 2 {
-		err = fmt.Errorf("文件没有后缀")
-	}
-	ext := fInfo[1]
-	fw, _ = bodyWriter.CreateFormField("id")
-	fw.Write([]byte("WU_FILE_0"))
-	fw, _ = bodyWriter.CreateFormField("name")
-	fw.Write([]byte(filename))
-	fw, _ = bodyWriter.CreateFormField("type")
-	if ext == "gif" {
-		fw.Write([]byte("image/gif"))
-	} else {
-		fw.Write([]byte("image/jpeg"))
+	w.Log.Printf("%s SendVideo: toUserName:%s;name:%s", w.GetUUID(), toUserName, name)
+	sent, err := w.sendUploaded(ctx, toUserName, name, size, MediaTypeVideo, r, func(mediaID string) (*SentMessage, error) {
+		msg := map[string]interface{}{
+			"Type":    MsgTypeVideo,
+			"MediaId": mediaID,
+			"Content": "",
+		}
+		return w.postMsg(ctx, WebWxSendVideoMsgPath, "fun=async&f=json", toUserName, msg)
+	})
+	if err != nil {
+		w.Log.Printf("%s SendVideo faild:%s", w.GetUUID(), err.Error())
+		return nil, err
 	}
-	fw, _ = bodyWriter.CreateFormField("lastModifieDate")
-	fw.Write([]byte("Mon Feb 13 2017 17:27:23 GMT+8000(CST)"))
-	fw, _ = bodyWriter.CreateFormField("size")
+	w.Log.Printf("%s SendVideo success", w.GetUUID())
+	return sent, nil
+}
 
-	fw.Write([]byte(strconv.FormatInt(fStat.Size(), 10)))
-	fw, _ = bodyWriter.CreateFormField("mediatype")
-	if ext == "gif" {
-		fw.Write([]byte("doc"))
-	} else {
-		fw.Write([]byte("pic"))
+// SendEmoticonReader 发送表情(gif)
+func (w *Wechat) SendEmoticonReader(ctx context.Context, toUserName, name string, size int64, r io.Reader) (*SentMessage, error) {
+	if !w.IsLogin() {
+		return nil, fmt.Errorf("请重新登录")
 	}
+	w.Log.Printf("%s SendEmoticon: toUserName:%s;name:%s", w.GetUUID(), toUserName, name)
+	sent, err := w.sendUploaded(ctx, toUserName, name, size, MediaTypeDoc, r, func(mediaID string) (*SentMessage, error) {
+		msg := map[string]interface{}{
+			"Type":      MsgTypeEmoticon,
+			"EmojiFlag": 2,
+			"MediaId":   mediaID,
+		}
+		return w.postMsg(ctx, WebWxSendEmoticonPath, "fun=sys&f=json", toUserName, msg)
+	})
 	if err != nil {
-		w.Log.Printf("UploadMedia: %s open faild %+v", w.GetUUID(), err)
-		return
+		w.Log.Printf("%s SendEmoticon faild:%s", w.GetUUID(), err.Error())
+		return nil, err
 	}
+	w.Log.Printf("%s SendEmoticon success", w.GetUUID())
+	return sent, nil
+}
 
-	wxurl := fmt.Sprintf("%s?pass_ticket=%s&fun=async&skey=%s&r=%d",
-		WebSendMediaURL,
-		w.Request.BaseRequest.PassTicket,
-		w.Request.BaseRequest.Skey,
-		time.Now().Unix(),
-	)
-	uploadResp := Request{
-		BaseRequest:   w.Request.BaseRequest,
-		TotalLen:      fStat.Size(),
-		StartPos:      0,
-		DataLen:       fStat.Size(),
-		ClientMediaID: mediaID,
-	}
-	jur, err := json.Marshal(uploadResp)
-	fw, _ = bodyWriter.CreateFormField("uploadmediarequest")
-	fw.Write(jur)
-	fw, _ = bodyWriter.CreateFormField("webwx_data_ticket")
-	fw, _ = bodyWriter.CreateFormField("pass_ticket")
-	fw.Write([]byte(w.Request.BaseRequest.PassTicket))
-	bodyWriter.Close()
-	req, err := http.NewRequest(http.MethodPost, wxurl, bodyBuf)
-	req.Header.Add("Content-Type", bodyWriter.FormDataContentType())
-	req.Header.Add("User-Agent", UserAgent)
-
+// sendPath 打开本地文件后发送
+func (w *Wechat) sendPath(toUserName, filePath string, send func(ctx context.Context, toUserName, name string, size int64, r io.Reader) (*SentMessage, error)) (*SentMessage, error) {
+	f, err := os.Open(filePath)
 	if err != nil {
-		w.Log.Printf("UploadMedia: %s NewRequest faild %+v", w.GetUUID(), err)
-		return
-	}
-	fmt.Println(wxurl)
-	resp, err := http.DefaultClient.Do(req)
-	if resp.StatusCode != http.StatusOK {
-		w.Log.Printf("UploadMedia: %s client do faild status code = %d", w.GetUUID(), resp.StatusCode)
-		return
+		w.Log.Printf("%s open file faild: %s", w.GetUUID(), err.Error())
+		return nil, err
 	}
+	defer f.Close()
+	fStat, err := f.Stat()
 	if err != nil {
-		w.Log.Printf("UploadMedia: %s client do faild %+v", w.GetUUID(), err)
-		return
+		w.Log.Printf("%s file stat faild: %s", w.GetUUID(), err.Error())
+		return nil, err
 	}
-	defer resp.Body.Close()
-	respBody, err := ioutil.ReadAll(resp.Body)
-	w.Log.Println("UploadMedia: respBody:", string(respBody))
-	mediaResp := new(MediaResponse)
-	if err = json.NewDecoder(bytes.NewReader(respBody)).Decode(mediaResp); err != io.EOF {
-		w.Log.Printf("UploadMedia: %s json decode faild %+v", w.GetUUID(), err)
-		return
+	return send(context.Background(), toUserName, filepath.Base(filePath), fStat.Size(), f)
+}
+
+// postMsg 补全发送人、LocalID后发送，返回可以撤回的消息
+func (w *Wechat) postMsg(ctx context.Context, path, query, toUserName string, msg map[string]interface{}) (*SentMessage, error) {
+	wxurl := fmt.Sprintf("%s?%s&pass_ticket=%s", w.apiURL(path), query, w.Request.BaseRequest.PassTicket)
+	localID := clientMsgID()
+	msg["FromUserName"] = w.User.UserName
+	msg["ToUserName"] = toUserName
+	msg["LocalID"] = localID
+	msg["ClientMsgId"] = localID
+	params := map[string]interface{}{
+		"BaseRequest": w.Request.BaseRequest,
+		"Msg":         msg,
+		"Scene":       0,
+	}
+	sendResp := new(SendMsgResponse)
+	if err := w.postJSON(ctx, wxurl, params, sendResp); err != nil {
+		return nil, err
+	}
+	if err := retError("发送失败", sendResp.BaseResponse); err != nil {
+		return nil, err
 	}
+	sent := &SentMessage{
+		MsgID:      sendResp.MsgID,
+		LocalID:    sendResp.LocalID,
+		ToUserName: toUserName,
+	}
+	if sent.LocalID == "" {
+		sent.LocalID = localID
+	}
+	return sent, nil
+}
 
-	w.Log.Printf("%+v", mediaResp)
-	return mediaResp.MediaID, nil
+// Revoke 撤回已发送的消息
+func (w *Wechat) Revoke(ctx context.Context, sent *SentMessage) error {
+	if !w.IsLogin() {
+		return fmt.Errorf("请重新登录")
+	}
+	if sent == nil || sent.MsgID == "" || sent.ToUserName == "" {
+		return fmt.Errorf("撤回失败: 消息不完整")
+	}
+	wxurl := fmt.Sprintf("%s?lang=zh_CN&pass_ticket=%s", w.apiURL(WebWxRevokeMsgPath), w.Request.BaseRequest.PassTicket)
+	params := map[string]interface{}{
+		"BaseRequest": w.Request.BaseRequest,
+		"ClientMsgId": sent.LocalID,
+		"SvrMsgId":    sent.MsgID,
+		"ToUserName":  sent.ToUserName,
+	}
+	resp := new(InnerResponse)
+	if err := w.postJSON(ctx, wxurl, params, resp); err != nil {
+		return err
+	}
+	return retError("撤回失败", resp.BaseResponse)
 }
 
 // fetchuuID get uuid
@@ -523,14 +593,6 @@ func (w *Wechat) fetchQr() error {
 	return nil
 }
 
-func (w *Wechat) setBaseURL() {
-	url, err := url.Parse(w.redirectedURL)
-	if err != nil {
-		w.Log.Print(err)
-	}
-	w.baseURL = fmt.Sprintf("%s://%s%s", url.Scheme, url.Hostname(), url.Path)
-}
-
 // waitForLogin fetch login status
 func (w *Wechat) waitForLogin(ctx context.Context) error {
 	w.Log.Printf("%s waitForLogin start", w.GetUUID())
@@ -592,24 +654,32 @@ func (w *Wechat) fetchForLogin(url string) (redirectedURL string, er error) {
 }
 
 // SyncCheck sync check
-func (w *Wechat) SyncCheck() (syncResp *SyncCheckResp, err error) {
+func (w *Wechat) SyncCheck(ctx context.Context) (syncResp *SyncCheckResp, err error) {
 	w.Log.Printf("SyncCheck: %s start", w.GetUUID())
 	params := url.Values{}
 	curTime := strconv.FormatInt(time.Now().Unix(), 10)
+	w.mu.RLock()
 	params.Set("r", curTime)
 	params.Set("sid", w.Request.BaseRequest.Wxsid)
 	params.Set("uin", strconv.FormatInt(int64(w.Request.BaseRequest.Wxuin), 10))
-	params.Set("sky", w.Request.BaseRequest.Skey)
-	params.Set("deviceid", w.SyncKeyStr)
+	params.Set("skey", w.Request.BaseRequest.Skey)
+	params.Set("deviceid", w.deviceID)
+	params.Set("synckey", w.SyncKeyStr)
 	params.Set("_", curTime)
-	checkURL, err := url.Parse(WebSyncCheckURL)
+	w.mu.RUnlock()
+	checkURL, err := url.Parse(w.pushURL(WebSyncCheckPath))
 	if err != nil {
 		w.Log.Printf("SyncCheck: %s faild: %+v", w.GetUUID(), err)
 		return
 	}
 	checkURL.RawQuery = params.Encode()
 	w.Log.Printf(checkURL.String())
-	resp, err := w.Client.Get(checkURL.String())
+	req, err := http.NewRequest(http.MethodGet, checkURL.String(), nil)
+	if err != nil {
+		w.Log.Printf("SyncCheck: %s faild: %+v", w.GetUUID(), err)
+		return
+	}
+	resp, err := w.Client.Do(req.WithContext(ctx))
 	if err != nil {
 		w.Log.Printf("SyncCheck: %s get faild: %+v", w.GetUUID(), err)
 		return
@@ -638,6 +708,51 @@ func (w *Wechat) SyncCheck() (syncResp *SyncCheckResp, err error) {
 	return
 }
 
+// postJSON post json params and decode json result
+func (w *Wechat) postJSON(ctx context.Context, wxurl string, params interface{}, result interface{}) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, wxurl, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", ContentTypeJSON)
+	req.Header.Set("User-Agent", UserAgent)
+	response, err := w.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("status code = %d", response.StatusCode)
+	}
+	return json.NewDecoder(response.Body).Decode(result)
+}
+
+// RetError 接口返回的Ret不为0
+type RetError struct {
+	Action string
+	Ret    int
+	ErrMsg string
+}
+
+func (e *RetError) Error() string {
+	return fmt.Sprintf("%s: ret=%d %s", e.Action, e.Ret, e.ErrMsg)
+}
+
+// retError 检查接口返回的BaseResponse
+func retError(action string, resp *BaseResponse) error {
+	if resp == nil {
+		return fmt.Errorf("%s", action)
+	}
+	if resp.Ret != StatusSuccess {
+		return &RetError{Action: action, Ret: resp.Ret, ErrMsg: resp.ErrMsg}
+	}
+	return nil
+}
+
 // getHTTPClient http client
 func getHTTPClient() *http.Client {
 	jar, err := cookiejar.New(nil)
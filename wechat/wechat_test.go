@@ -1,6 +1,14 @@
 package wechat
 
-import "testing"
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
 
 func TestUploadMedia(t *testing.T) {
 	wechat := NewWechat(GetLogger())
@@ -12,3 +20,132 @@ func TestUploadMedia(t *testing.T) {
 	}
 	t.Fail()
 }
+
+func TestSendFile(t *testing.T) {
+	var content string
+	w, server := newTestWechat(t, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case APIPath + WebUploadMediaPath:
+			if v := req.FormValue("mediatype"); v != MediaTypeDoc {
+				t.Errorf("mediatype: %s", v)
+			}
+			rw.Write([]byte(`{"BaseResponse":{"Ret":0,"ErrMsg":""},"MediaId":"@crypt_media"}`))
+		case APIPath + WebWxSendAppMsgPath:
+			params := struct {
+				Msg struct {
+					Type    int
+					Content string
+				}
+			}{}
+			json.NewDecoder(req.Body).Decode(&params)
+			content = params.Msg.Content
+			rw.Write([]byte(`{"BaseResponse":{"Ret":0,"ErrMsg":""},"MsgID":"1","LocalID":"2"}`))
+		default:
+			http.NotFound(rw, req)
+		}
+	}))
+	defer server.Close()
+
+	f, err := ioutil.TempFile("", "report.final.*.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.Write([]byte("%PDF-1.4"))
+	f.Close()
+
+	if _, err := w.SendFile("@friend", f.Name()); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(content, "<attachid>@crypt_media</attachid>") ||
+		!strings.Contains(content, "<totallen>8</totallen>") ||
+		!strings.Contains(content, "<fileext>pdf</fileext>") {
+		t.Fatalf("%s", content)
+	}
+}
+
+func TestSendVideoAndEmoticon(t *testing.T) {
+	sent := map[string]int{}
+	var mediaType string
+	w, server := newTestWechat(t, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == APIPath+WebUploadMediaPath {
+			mediaType = req.FormValue("mediatype")
+			rw.Write([]byte(`{"BaseResponse":{"Ret":0,"ErrMsg":""},"MediaId":"@crypt_media"}`))
+			return
+		}
+		params := struct {
+			Msg struct {
+				Type    int
+				MediaID string `json:"MediaId"`
+			}
+		}{}
+		json.NewDecoder(req.Body).Decode(&params)
+		if params.Msg.MediaID != "@crypt_media" {
+			t.Errorf("MediaId: %s", params.Msg.MediaID)
+		}
+		sent[strings.TrimPrefix(req.URL.Path, APIPath)] = params.Msg.Type
+		rw.Write([]byte(`{"BaseResponse":{"Ret":0,"ErrMsg":""},"MsgID":"1","LocalID":"2"}`))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "wxapi-media")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	video := dir + "/clip.mp4"
+	emoticon := dir + "/sticker.gif"
+	ioutil.WriteFile(video, []byte("video"), 0644)
+	ioutil.WriteFile(emoticon, []byte("GIF89a"), 0644)
+
+	if _, err := w.SendVideo("@friend", video); err != nil {
+		t.Fatal(err)
+	}
+	if mediaType != MediaTypeVideo || sent[WebWxSendVideoMsgPath] != int(MsgTypeVideo) {
+		t.Fatalf("%s %v", mediaType, sent)
+	}
+	if _, err := w.SendMedia("@friend", emoticon); err != nil {
+		t.Fatal(err)
+	}
+	if mediaType != MediaTypeDoc || sent[WebWxSendEmoticonPath] != int(MsgTypeEmoticon) {
+		t.Fatalf("%s %v", mediaType, sent)
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	var revoke map[string]interface{}
+	w, server := newTestWechat(t, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case APIPath + WebWxSendMsgPath:
+			rw.Write([]byte(`{"BaseResponse":{"Ret":0,"ErrMsg":""},"MsgID":"1001","LocalID":"2002"}`))
+		case APIPath + WebWxRevokeMsgPath:
+			json.NewDecoder(req.Body).Decode(&revoke)
+			rw.Write([]byte(`{"BaseResponse":{"Ret":0,"ErrMsg":""},"Introduction":"","SysWording":""}`))
+		default:
+			http.NotFound(rw, req)
+		}
+	}))
+	defer server.Close()
+
+	sent, err := w.SendMsg("@friend", "hello", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent.MsgID != "1001" || sent.LocalID != "2002" || sent.ToUserName != "@friend" {
+		t.Fatalf("%+v", sent)
+	}
+	if err := w.Revoke(context.Background(), sent); err != nil {
+		t.Fatal(err)
+	}
+	if revoke["SvrMsgId"] != "1001" || revoke["ClientMsgId"] != "2002" || revoke["ToUserName"] != "@friend" {
+		t.Fatalf("%v", revoke)
+	}
+	if err := w.Revoke(context.Background(), &SentMessage{}); err == nil {
+		t.Fatal("empty message revoked")
+	}
+	revoke = nil
+	w.Request.BaseRequest.PassTicket = ""
+	if err := w.Revoke(context.Background(), sent); err == nil || revoke != nil {
+		t.Fatalf("revoked without login: %v %v", err, revoke)
+	}
+}